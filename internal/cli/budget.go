@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// patternBudgets enforces the per-pattern limits on kept lines (see
+// --per-pattern-limit), counting the lines suppressed once a pattern's limit
+// is reached. Patterns are identified by name, rather than index, so the
+// counts survive reloading the pattern files.
+type patternBudgets struct {
+	budgets  map[string]*patternBudget
+	exceeded []*patternBudget // in the order their limits were reached
+}
+
+type patternBudget struct {
+	name       string
+	kept       int
+	suppressed int
+}
+
+// allow returns true if lines matching pattern i of m may be kept, counting
+// them either way, where lines is the number of lines (e.g. of a multi-line
+// record), which count as one against the limit.
+func (b *patternBudgets) allow(m *matcher, i int, lines int) bool {
+	limit := m.limit(i)
+	if limit <= 0 {
+		return true
+	}
+	name := m.name(i)
+	budget := b.budgets[name]
+	if budget == nil {
+		if b.budgets == nil {
+			b.budgets = make(map[string]*patternBudget)
+		}
+		budget = &patternBudget{name: name}
+		b.budgets[name] = budget
+	}
+	if budget.kept < limit {
+		budget.kept++
+		return true
+	}
+	if budget.suppressed == 0 {
+		b.exceeded = append(b.exceeded, budget)
+	}
+	budget.suppressed += lines
+	return false
+}
+
+// report writes a line for each pattern that exceeded its limit, e.g.
+// `pattern "deprecated: *" suppressed 10 more lines`.
+func (b *patternBudgets) report(w io.Writer, terminator []byte) {
+	for _, budget := range b.exceeded {
+		suffix := `s`
+		if budget.suppressed == 1 {
+			suffix = ``
+		}
+		_, _ = fmt.Fprintf(w, "pattern %s suppressed %d more line%s%s", budget.name, budget.suppressed, suffix, terminator)
+	}
+}
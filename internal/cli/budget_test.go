@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func Test_patternBudgets(t *testing.T) {
+	m := &matcher{
+		patterns: []*regexp.Regexp{compileSinglePattern("a*"), compileSinglePattern("b*"), compileSinglePattern("c*")},
+		limits:   []int{2, 0, 1},
+		names:    []string{`"a*"`, `"b*"`, `"c*" (f:3)`},
+	}
+	var b patternBudgets
+	var got []bool
+	for _, i := range [...]int{0, 1, 2, 0, 2, 0, 1, 0} {
+		got = append(got, b.allow(m, i, 1))
+	}
+	// N.B. counts survive replacing the matcher, e.g. on reload
+	reloaded := &matcher{patterns: m.patterns[:1], limits: m.limits[:1], names: m.names[:1]}
+	got = append(got, b.allow(reloaded, 0, 3))
+
+	expected := []bool{true, true, true, true, false, false, true, false, false}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("allow() = %v, want %v", got, expected)
+		}
+	}
+
+	var out bytes.Buffer
+	b.report(&out, []byte("\n"))
+	if expected := "pattern \"c*\" (f:3) suppressed 1 more line\npattern \"a*\" suppressed 5 more lines\n"; out.String() != expected {
+		t.Errorf("report() = %q, want %q", out.String(), expected)
+	}
+}
+
+func TestCLI_compilePatterns_limits(t *testing.T) {
+	cli := CLI{rawPatterns: []string{"a*", "b*"}, perPatternLimit: 3}
+	m, err := cli.compilePatterns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.limit(0) != 3 || m.limit(1) != 3 || m.name(1) != `"b*"` {
+		t.Errorf("got limits %v, names %q", m.limits, m.names)
+	}
+
+	cli.perPatternLimit = 0
+	if m, err = cli.compilePatterns(); err != nil {
+		t.Fatal(err)
+	}
+	if m.limits != nil || m.limit(0) != 0 {
+		t.Errorf("got limits %v", m.limits)
+	}
+}
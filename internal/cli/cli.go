@@ -7,27 +7,92 @@ import (
 	"io"
 	"os/exec"
 	"regexp"
+	"time"
 )
 
 type CLI struct {
-	Input            io.Reader
-	Output           io.Writer
-	ErrOut           io.Writer
-	flagSet          *flag.FlagSet
-	command          string
-	errorMode        errorMode
-	rawPatterns      stringSliceFlag
-	patternFiles     stringSliceFlag
-	compiledPatterns []*regexp.Regexp
-	args             []string
-	invertMatch      bool // like grep -v
+	Input  io.Reader
+	Output io.Writer
+	ErrOut io.Writer
+	// LookupEnv is used to read option defaults from the environment, and
+	// may be nil, e.g. to ignore the environment.
+	LookupEnv func(key string) (string, bool)
+	// Environ is used to warn about unrecognized SCOF_* environment
+	// variables (e.g. typos), and may be nil.
+	Environ func() []string
+
+	flagSet                  *flag.FlagSet
+	command                  string
+	errorMode                errorMode
+	rawPatterns              stringSliceFlag
+	patternFiles             stringSliceFlag
+	presets                  stringSliceFlag
+	compiledPatterns         []*regexp.Regexp
+	patternLimits            []int
+	patternNames             []string
+	patternStreams           []patternStream
+	patternExcludes          []bool
+	perPatternLimit          int
+	args                     []string
+	invertMatch              bool // like grep -v
+	reloadInterval           time.Duration
+	strictPatterns           bool
+	pathGlob                 bool
+	maxLineLength            int
+	longLinePolicy           longLinePolicy
+	crSegments               bool
+	nullData                 bool
+	recordSeparator          string
+	recordSeparatorRegex     string
+	separator                []byte
+	separatorRegex           *regexp.Regexp
+	binaryPolicy             binaryPolicy
+	afterContext             int
+	beforeContext            int
+	aroundContext            int
+	groupSeparator           string
+	noGroupSeparator         bool
+	multiline                stringSliceFlag
+	maxCount                 int
+	maxCountAction           maxCountAction
+	lineNumbers              bool
+	timestamp                timestampFormat
+	collapseRepeats          bool
+	collapseNormalize        stringSliceFlag
+	collapseNormalizeRegexes []*regexp.Regexp
+	collapseInterval         time.Duration
+	rateLimit                rateLimit
+	lineBuffered             bool
+	workers                  int
+	rawLogPath               string
+	rawLogMaxSize            byteSize
+	rawLogMaxFiles           int
+	rawLogGzip               bool
+	rejectedPath             string
+	rejectedFD               int
+	stderrRawPatterns        stringSliceFlag
+	stderrPatternFiles       stringSliceFlag
+	stderrInvert             bool
+	stderrMatcher            *matcher
+	errorModeStderr          bool
+	merge                    bool
+	streamTags               streamTags
+	listPresets              bool
+	showOptions              bool
+	options                  []*optionGroup
 }
 
-var errNoCommand = errors.New("no command specified")
+var (
+	errNoCommand = errors.New("no command specified")
+
+	// errNoRun indicates init successfully handled an option like
+	// --list-presets, and there is nothing left to do.
+	errNoRun = errors.New("exiting without running a command")
+)
 
 func (x *CLI) Main(args []string) int {
 	if err := x.init(args); err != nil {
-		if errors.Is(err, flag.ErrHelp) {
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, errNoRun) {
 			return 0
 		}
 
@@ -98,6 +98,24 @@ func TestCLI_Main_integration(t *testing.T) {
 			expectedOutput: "hello world\n",
 			expectedCode:   0, // Should exit 0
 		},
+		{
+			name:           "with preset",
+			args:           []string{"--preset", "npm-warnings", "printf", "added 1 package\nnpm WARN deprecated foo\n"},
+			expectedOutput: "npm WARN deprecated foo\n",
+			expectedCode:   0,
+		},
+		{
+			name:           "with preset and pattern",
+			args:           []string{"--preset", "npm-warnings", "-p", "added*", "printf", "added 1 package\nnpm WARN deprecated foo\n"},
+			expectedOutput: "added 1 package\nnpm WARN deprecated foo\n",
+			expectedCode:   0,
+		},
+		{
+			name:           "with unknown preset",
+			args:           []string{"--preset", "bogus", "echo", "hello"},
+			expectedOutput: "",
+			expectedCode:   2,
+		},
 		{
 			name:           "invalid error mode value",
 			args:           []string{"-e", "bogus", "echo", "hello"},
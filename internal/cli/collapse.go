@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// repeatCollapser collapses runs of repeated kept lines (--collapse-repeats),
+// where only the first line of each run is written, followed by a summary
+// line, once the run ends, or, optionally, after an interval.
+//
+// Anything other than kept lines must be written via Write, which ends the
+// run. This also guarantees the interval timer, which writes the summary,
+// never writes concurrently with the caller.
+type repeatCollapser struct {
+	mu         sync.Mutex
+	w          io.Writer
+	normalize  []*regexp.Regexp
+	interval   time.Duration // 0 to only summarize once the run ends
+	terminator []byte
+	previous   []byte // the normalized previous kept line, if any
+	any        bool   // previous is valid
+	count      int    // repeats since the previous line or summary was written
+	timer      *time.Timer
+	generation int // identifies the current timer
+}
+
+// newRepeatCollapser returns nil if repeats aren't collapsed.
+func (x *CLI) newRepeatCollapser(w io.Writer) *repeatCollapser {
+	if !x.collapseRepeats {
+		return nil
+	}
+	return &repeatCollapser{
+		w:          w,
+		normalize:  x.collapseNormalizeRegexes,
+		interval:   x.collapseInterval,
+		terminator: x.recordTerminator(),
+	}
+}
+
+// compileCollapseNormalize compiles the --collapse-normalize regexes.
+func (x *CLI) compileCollapseNormalize() error {
+	x.collapseNormalizeRegexes = nil
+	for _, s := range x.collapseNormalize {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("invalid collapse normalize regex %q: %w", s, err)
+		}
+		x.collapseNormalizeRegexes = append(x.collapseNormalizeRegexes, re)
+	}
+	return nil
+}
+
+// repeated returns true if line repeats the previous kept line, in which
+// case it is counted, and must not be written. Otherwise, the summary of any
+// previous run is written, and the caller must write line.
+func (c *repeatCollapser) repeated(line []byte) bool {
+	for _, re := range c.normalize {
+		line = re.ReplaceAllLiteral(line, nil)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.any && string(c.previous) == string(line) {
+		c.count++
+		if c.count == 1 && c.interval > 0 {
+			c.generation++
+			generation := c.generation
+			c.timer = time.AfterFunc(c.interval, func() {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				if c.generation == generation {
+					c.flushLocked()
+				}
+			})
+		}
+		return true
+	}
+
+	c.flushLocked()
+	c.previous = append(c.previous[:0], line...)
+	c.any = true
+	return false
+}
+
+// Write writes p, other than a kept line, ending any run, and writing its
+// summary first.
+func (c *repeatCollapser) Write(p []byte) (int, error) {
+	c.reset()
+	return c.w.Write(p)
+}
+
+// writeLine writes a line, like Write, see lineWriter.
+func (c *repeatCollapser) writeLine(p, line []byte) {
+	c.reset()
+	writeLine(c.w, p, line)
+}
+
+// flush writes the summary of the current run, if any.
+func (c *repeatCollapser) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+}
+
+// reset flushes, then forgets the previous kept line, e.g. because the
+// caller wrote a line that wasn't compared.
+func (c *repeatCollapser) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+	c.any = false
+}
+
+func (c *repeatCollapser) flushLocked() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+		c.generation++
+	}
+	if c.count == 0 {
+		return
+	}
+	suffix := `s`
+	if c.count == 1 {
+		suffix = ``
+	}
+	_, _ = fmt.Fprintf(c.w, "last line repeated %d time%s%s", c.count, suffix, c.terminator)
+	c.count = 0
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_repeatCollapser(t *testing.T) {
+	for _, tc := range [...]struct {
+		name      string
+		normalize []string
+		input     string // lines, where a '~' prefix marks other output
+		expected  string
+	}{
+		{"no repeats", nil, "a b c", "a b c"},
+		{"run", nil, "a a a b", "a [2] b"},
+		{"single repeat", nil, "a a b b", "a [1] b [1]"},
+		{"run at end", nil, "a b b b", "a b [2]"},
+		{"empty lines", nil, "x _ _ _ y", "x _ [2] y"},
+		{"other output ends run", nil, "a a ~c a a", "a [1] ~c a [1]"},
+		{"normalize", []string{`^\d+:`}, "1:a 2:a 3:b 4:a", "1:a [1] 3:b 4:a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			cli := CLI{collapseRepeats: true, collapseNormalize: tc.normalize}
+			if err := cli.compileCollapseNormalize(); err != nil {
+				t.Fatal(err)
+			}
+			c := cli.newRepeatCollapser(&b)
+			c.terminator = []byte(" ")
+			for _, token := range strings.Fields(tc.input) {
+				line := strings.TrimPrefix(token, "_") // empty line
+				if _, ok := strings.CutPrefix(line, "~"); ok {
+					_, _ = c.Write([]byte(token + " "))
+				} else if !c.repeated([]byte(line)) {
+					b.WriteString(token + " ")
+				}
+			}
+			c.flush()
+			got := regexp.MustCompile(`last line repeated (\d+) times? `).ReplaceAllString(b.String(), "[$1] ")
+			if got = strings.TrimSpace(strings.Join(strings.Fields(got), " ")); got != tc.expected {
+				t.Errorf("got %q, want %q (raw %q)", got, tc.expected, b.String())
+			}
+		})
+	}
+}
+
+func Test_repeatCollapser_interval(t *testing.T) {
+	var (
+		mu sync.Mutex
+		b  bytes.Buffer
+	)
+	c := (&CLI{collapseRepeats: true, collapseInterval: 50 * time.Millisecond}).newRepeatCollapser(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return b.Write(p)
+	}))
+	for range 3 {
+		if c.repeated([]byte("a")) {
+			continue
+		}
+		_, _ = c.w.Write([]byte("a\n"))
+	}
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	got := b.String()
+	mu.Unlock()
+	if expected := "a\nlast line repeated 2 times\n"; got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+	c.flush()
+	if b.String() != got {
+		t.Errorf("unexpected second summary: %q", b.String())
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestCLI_compileCollapseNormalize(t *testing.T) {
+	cli := CLI{collapseNormalize: []string{"("}}
+	if err := cli.compileCollapseNormalize(); err == nil || !strings.Contains(err.Error(), "invalid collapse normalize regex") {
+		t.Errorf("error = %v", err)
+	}
+}
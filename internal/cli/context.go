@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"io"
+)
+
+// contextLines writes the lines surrounding kept lines (-A, -B, -C), where
+// lines before a kept line are buffered in a ring, and non-contiguous groups
+// of lines are separated by a separator line. Lines which won't be written
+// (e.g. evicted from the ring) are passed to reject, if set, so each line is
+// either written, or rejected, but never both.
+type contextLines struct {
+	w         io.Writer // for the separator
+	write     func(line []byte, info lineInfo)
+	before    lineRing
+	after     int    // number of lines to write after each kept line
+	remaining int    // number of lines still to write after the last kept line
+	separator []byte // the group separator, including its terminator, or nil
+	written   bool   // any line has been written
+	skipped   bool   // lines were skipped since the last line written
+}
+
+// newContextLines returns nil if there are no context lines to write. Lines
+// are written using write, and separators directly to w, where reject may be
+// nil.
+func (x *CLI) newContextLines(w io.Writer, write, reject func(line []byte, info lineInfo)) *contextLines {
+	before, after := max(x.beforeContext, x.aroundContext), max(x.afterContext, x.aroundContext)
+	if before <= 0 && after <= 0 {
+		return nil
+	}
+	c := contextLines{
+		w:      w,
+		write:  write,
+		before: newLineRing(before),
+		after:  after,
+	}
+	c.before.evicted = reject
+	if !x.noGroupSeparator {
+		c.separator = append([]byte(x.groupSeparator), x.recordTerminator()...)
+	}
+	return &c
+}
+
+// recordTerminator returns the terminator used for lines written by the
+// filter itself, i.e. the record separator, if it is a byte string.
+func (x *CLI) recordTerminator() []byte {
+	if x.separator != nil {
+		return x.separator
+	}
+	return newline
+}
+
+// kept writes any buffered lines, preceding a kept line, which the caller
+// must write, immediately after.
+func (c *contextLines) kept() {
+	if c.skipped && c.written && c.separator != nil {
+		_, _ = c.w.Write(c.separator)
+	}
+	c.before.drain(c.write)
+	c.skipped = false
+	c.written = true
+	c.remaining = c.after
+}
+
+// suppressed handles a line that was not kept, writing it, if it follows a
+// kept line, or otherwise buffering it, in case it precedes one.
+func (c *contextLines) suppressed(line []byte, info lineInfo) {
+	if c.remaining > 0 {
+		c.remaining--
+		c.write(line, info)
+		return
+	}
+	if c.before.push(line, info) {
+		c.skipped = true
+	}
+}
+
+// dropped handles a line that was neither kept, nor may be used as context,
+// which the caller must reject, after any buffered lines.
+func (c *contextLines) dropped() {
+	c.before.reset()
+	c.remaining = 0
+	c.skipped = true
+}
+
+// following returns true if the next suppressed line would be written, as
+// it follows a kept line.
+func (c *contextLines) following() bool {
+	return c.remaining > 0
+}
+
+// flush rejects any buffered lines, once there are no more kept lines.
+func (c *contextLines) flush() {
+	c.before.reset()
+}
+
+// lineRing is a fixed-size ring buffer of lines, which are copied, reusing
+// the storage of any line it replaces.
+type lineRing struct {
+	lines [][]byte
+	infos []lineInfo
+	start int
+	n     int
+
+	// evicted is called, if set, with each line removed other than by
+	// drain, i.e. evicted, discarded (by an empty ring), or reset
+	evicted func(line []byte, info lineInfo)
+}
+
+func newLineRing(size int) lineRing {
+	return lineRing{
+		lines: make([][]byte, size),
+		infos: make([]lineInfo, size),
+	}
+}
+
+// push adds a copy of line, returning true if the oldest line was evicted,
+// or, for an empty ring, if line was discarded.
+func (r *lineRing) push(line []byte, info lineInfo) bool {
+	if len(r.lines) == 0 {
+		if r.evicted != nil {
+			r.evicted(line, info)
+		}
+		return true
+	}
+	i := (r.start + r.n) % len(r.lines)
+	if r.n == len(r.lines) && r.evicted != nil {
+		r.evicted(r.lines[i], r.infos[i])
+	}
+	r.lines[i] = append(r.lines[i][:0], line...)
+	r.infos[i] = info
+	if r.n < len(r.lines) {
+		r.n++
+		return false
+	}
+	r.start = (r.start + 1) % len(r.lines)
+	return true
+}
+
+// drain calls fn with the buffered lines, oldest first, then resets the
+// ring.
+func (r *lineRing) drain(fn func(line []byte, info lineInfo)) {
+	for i := 0; i < r.n; i++ {
+		j := (r.start + i) % len(r.lines)
+		fn(r.lines[j], r.infos[j])
+	}
+	r.start = 0
+	r.n = 0
+}
+
+// reset removes the buffered lines, as per drain, though they are passed to
+// evicted, if set.
+func (r *lineRing) reset() {
+	if r.evicted != nil {
+		r.drain(r.evicted)
+		return
+	}
+	r.start = 0
+	r.n = 0
+}
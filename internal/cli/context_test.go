@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_lineRing(t *testing.T) {
+	r := newLineRing(2)
+	var evicted []bool
+	for i, line := range [...]string{"a", "b", "c", "d"} {
+		evicted = append(evicted, r.push([]byte(line), lineInfo{number: i + 1}))
+	}
+	if expected := []bool{false, false, true, true}; !slices.Equal(evicted, expected) {
+		t.Errorf("evicted = %v, want %v", evicted, expected)
+	}
+	var b bytes.Buffer
+	drain := func(line []byte, info lineInfo) {
+		fmt.Fprintf(&b, "%d%s", info.number, line)
+	}
+	r.drain(drain)
+	if b.String() != "3c4d" {
+		t.Errorf("drained %q, want %q", b.String(), "3c4d")
+	}
+	b.Reset()
+	r.drain(drain)
+	if b.Len() != 0 {
+		t.Errorf("drained %q after reset", b.String())
+	}
+
+	var empty lineRing
+	if !empty.push([]byte("x"), lineInfo{}) {
+		t.Error("expected empty ring to discard")
+	}
+
+	b.Reset()
+	r.evicted = drain
+	for i, line := range [...]string{"e", "f", "g"} {
+		r.push([]byte(line), lineInfo{number: i + 5})
+	}
+	r.reset()
+	if b.String() != "5e6f7g" {
+		t.Errorf("evicted %q, want %q", b.String(), "5e6f7g")
+	}
+	empty.evicted = drain
+	b.Reset()
+	empty.push([]byte("x"), lineInfo{number: 1})
+	if b.String() != "1x" {
+		t.Errorf("evicted %q from empty ring, want %q", b.String(), "1x")
+	}
+}
+
+func TestCLI_newContextLines(t *testing.T) {
+	for _, tc := range [...]struct {
+		name          string
+		cli           CLI
+		nil           bool
+		before, after int
+		separator     string
+	}{
+		{name: "disabled", nil: true},
+		{name: "after", cli: CLI{afterContext: 2, groupSeparator: "--"}, after: 2, separator: "--\n"},
+		{name: "before", cli: CLI{beforeContext: 3, groupSeparator: "--"}, before: 3, separator: "--\n"},
+		{name: "around", cli: CLI{aroundContext: 1, afterContext: 4, groupSeparator: "=="}, before: 1, after: 4, separator: "==\n"},
+		{name: "no separator", cli: CLI{aroundContext: 1, groupSeparator: "--", noGroupSeparator: true}, before: 1, after: 1},
+		{name: "nul", cli: CLI{aroundContext: 1, groupSeparator: "--", separator: []byte{0}}, before: 1, after: 1, separator: "--\x00"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.cli.newContextLines(nil, nil, nil)
+			if c == nil {
+				if !tc.nil {
+					t.Fatal("unexpected nil")
+				}
+				return
+			}
+			if tc.nil {
+				t.Fatal("expected nil")
+			}
+			if len(c.before.lines) != tc.before || c.after != tc.after || string(c.separator) != tc.separator {
+				t.Errorf("got before=%d after=%d separator=%q", len(c.before.lines), c.after, c.separator)
+			}
+		})
+	}
+}
+
+func Test_contextLines(t *testing.T) {
+	for _, tc := range [...]struct {
+		name          string
+		before, after int
+		input         string // lines, where 'k' is kept, 'd' is dropped
+		expected      string
+	}{
+		{"after", 0, 1, "0 1k 2 3 4k 5 6", "1k 2 -- 4k 5"},
+		{"before", 2, 0, "0 1 2 3k 4 5k 6", "1 2 3k 4 5k"},
+		{"before at start", 2, 0, "0k 1 2k", "0k 1 2k"},
+		{"contiguous", 1, 1, "0 1k 2 3k 4 5 6 7k", "0 1k 2 3k 4 -- 6 7k"},
+		{"overlap", 2, 2, "0k 1 2 3 4k", "0k 1 2 3 4k"},
+		{"gap of one", 1, 1, "0k 1 2 3 4k", "0k 1 -- 3 4k"},
+		{"dropped", 1, 1, "0k 1d 2 3k", "0k -- 2 3k"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			c := contextLines{
+				w:         &b,
+				write:     func(line []byte, info lineInfo) { b.Write(line) },
+				before:    newLineRing(tc.before),
+				after:     tc.after,
+				separator: []byte("-- "),
+			}
+			for _, line := range strings.Fields(tc.input) {
+				switch {
+				case strings.HasSuffix(line, "k"):
+					c.kept()
+					b.WriteString(line + " ")
+				case strings.HasSuffix(line, "d"):
+					c.dropped()
+				default:
+					c.suppressed([]byte(line+" "), lineInfo{})
+				}
+			}
+			if got := strings.TrimSpace(b.String()); got != tc.expected {
+				t.Errorf("got %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// directivePrefix starts the optional header (first line) of a pattern
+// file, which sets options for just that file, e.g.
+// "#!scof syntax=regex case=insensitive anchor=none". The same directives may
+// also follow an individual pattern, as a comment, e.g.
+// "deprecated: * #!scof limit=5", to set options for just that pattern.
+const directivePrefix = `#!scof`
+
+// limitNone is patternOptions.limit, if explicitly unlimited.
+const limitNone = -1
+
+const (
+	syntaxWildcard patternSyntax = `wildcard`
+	syntaxPathGlob patternSyntax = `path-glob`
+	syntaxRegex    patternSyntax = `regex`
+
+	caseSensitive   patternCase = `sensitive`
+	caseInsensitive patternCase = `insensitive`
+
+	anchorLine patternAnchor = `line`
+	anchorNone patternAnchor = `none`
+
+	streamAny patternStream = `any`
+	streamOut patternStream = `out`
+	streamErr patternStream = `err`
+
+	excludeFalse patternExclude = `false`
+	excludeTrue  patternExclude = `true`
+)
+
+type (
+	patternSyntax  string
+	patternCase    string
+	patternAnchor  string
+	patternStream  string
+	patternExclude string
+
+	// patternOptions configure how patterns are compiled. Zero values
+	// indicate that the default should be used.
+	patternOptions struct {
+		syntax   patternSyntax
+		caseMode patternCase
+		anchor   patternAnchor
+		// limit is the maximum number of lines the pattern may keep, or
+		// limitNone, see --per-pattern-limit
+		limit int
+		// stream restricts the pattern to lines from stdout or stderr, see
+		// --merge
+		stream patternStream
+		// exclude makes the pattern suppress the lines it matches, see
+		// matcher.excluded
+		exclude patternExclude
+	}
+
+	// rawPattern is a pattern prior to compilation.
+	rawPattern struct {
+		text    string
+		options patternOptions
+		// source identifies where the pattern came from, e.g. file:line,
+		// and may be empty
+		source string
+	}
+)
+
+func (x patternSyntax) Valid() bool {
+	switch x {
+	case syntaxWildcard, syntaxPathGlob, syntaxRegex:
+		return true
+	}
+	return false
+}
+
+func (x patternCase) Valid() bool {
+	switch x {
+	case caseSensitive, caseInsensitive:
+		return true
+	}
+	return false
+}
+
+func (x patternAnchor) Valid() bool {
+	switch x {
+	case anchorLine, anchorNone:
+		return true
+	}
+	return false
+}
+
+func (x patternStream) Valid() bool {
+	switch x {
+	case streamAny, streamOut, streamErr:
+		return true
+	}
+	return false
+}
+
+func (x patternExclude) Valid() bool {
+	switch x {
+	case excludeFalse, excludeTrue:
+		return true
+	}
+	return false
+}
+
+// or returns x, with any unset options taken from defaults.
+func (x patternOptions) or(defaults patternOptions) patternOptions {
+	if x.syntax == `` {
+		x.syntax = defaults.syntax
+	}
+	if x.caseMode == `` {
+		x.caseMode = defaults.caseMode
+	}
+	if x.anchor == `` {
+		x.anchor = defaults.anchor
+	}
+	if x.limit == 0 {
+		x.limit = defaults.limit
+	}
+	if x.stream == `` {
+		x.stream = defaults.stream
+	}
+	if x.exclude == `` {
+		x.exclude = defaults.exclude
+	}
+	return x
+}
+
+// isDirectiveHeader returns true if line is a directive header, though it
+// may not be valid.
+func isDirectiveHeader(line string) bool {
+	rest, ok := strings.CutPrefix(line, directivePrefix)
+	if !ok {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return rest == `` || unicode.IsSpace(r)
+}
+
+// parseDirectiveHeader parses the options from a directive header, see
+// isDirectiveHeader. Errors are reported using filePath and the line number,
+// which is always 1.
+func parseDirectiveHeader(filePath string, line string) (patternOptions, error) {
+	return parseDirectives(filePath, 1, line, 0)
+}
+
+// findInlineDirective returns the index of a directive comment following a
+// pattern (see directivePrefix), or -1. As per stripCommentFromLine, a
+// comment starts at the first '#' that isn't doubled.
+func findInlineDirective(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '#' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] == '#' {
+			i++
+			continue
+		}
+		if isDirectiveHeader(line[i:]) {
+			return i
+		}
+		return -1
+	}
+	return -1
+}
+
+// parseDirectives parses the options from the directives starting at
+// line[start:], which must be a directive header, or inline directive, see
+// findInlineDirective. Errors are reported using filePath and lineNumber.
+func parseDirectives(filePath string, lineNumber int, line string, start int) (patternOptions, error) {
+	var (
+		options patternOptions
+		seen    = make(map[string]bool)
+	)
+
+	for i := start + len(directivePrefix); i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+
+		start := i
+		for i < len(line) {
+			r, size := utf8.DecodeRuneInString(line[i:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			i += size
+		}
+		token := line[start:i]
+
+		fail := func(format string, a ...any) error {
+			return &patternFileError{
+				filePath: filePath,
+				line:     lineNumber,
+				col:      utf8.RuneCountInString(line[:start]) + 1,
+				msg:      fmt.Sprintf(format, a...),
+			}
+		}
+
+		key, value, ok := strings.Cut(token, `=`)
+		if !ok {
+			return patternOptions{}, fail("invalid directive %q, expected key=value", token)
+		}
+		if seen[key] {
+			return patternOptions{}, fail("duplicate directive %q", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case `syntax`:
+			options.syntax = patternSyntax(value)
+			if !options.syntax.Valid() {
+				return patternOptions{}, fail("invalid syntax %q, expected %q, %q, or %q", value, syntaxWildcard, syntaxPathGlob, syntaxRegex)
+			}
+		case `case`:
+			options.caseMode = patternCase(value)
+			if !options.caseMode.Valid() {
+				return patternOptions{}, fail("invalid case %q, expected %q or %q", value, caseSensitive, caseInsensitive)
+			}
+		case `anchor`:
+			options.anchor = patternAnchor(value)
+			if !options.anchor.Valid() {
+				return patternOptions{}, fail("invalid anchor %q, expected %q or %q", value, anchorLine, anchorNone)
+			}
+		case `limit`:
+			if value == `none` {
+				options.limit = limitNone
+			} else if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				options.limit = n
+			} else {
+				return patternOptions{}, fail("invalid limit %q, expected a positive integer or %q", value, `none`)
+			}
+		case `stream`:
+			options.stream = patternStream(value)
+			if !options.stream.Valid() {
+				return patternOptions{}, fail("invalid stream %q, expected %q, %q, or %q", value, streamOut, streamErr, streamAny)
+			}
+		case `exclude`:
+			options.exclude = patternExclude(value)
+			if !options.exclude.Valid() {
+				return patternOptions{}, fail("invalid exclude %q, expected %q or %q", value, excludeTrue, excludeFalse)
+			}
+		default:
+			return patternOptions{}, fail("unknown directive %q", key)
+		}
+	}
+
+	return options, nil
+}
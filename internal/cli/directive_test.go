@@ -0,0 +1,258 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseDirectiveHeader(t *testing.T) {
+	for _, tc := range [...]struct {
+		name      string
+		line      string
+		isHeader  bool
+		expected  patternOptions
+		wantError string
+	}{
+		{"no options", "#!scof", true, patternOptions{}, ""},
+		{"all options", "#!scof syntax=regex case=insensitive anchor=none", true, patternOptions{syntax: syntaxRegex, caseMode: caseInsensitive, anchor: anchorNone}, ""},
+		{"some options", "#!scof   case=insensitive  ", true, patternOptions{caseMode: caseInsensitive}, ""},
+		{"defaults explicitly", "#!scof syntax=wildcard case=sensitive anchor=line", true, patternOptions{syntax: syntaxWildcard, caseMode: caseSensitive, anchor: anchorLine}, ""},
+		{"comment", "# scof syntax=regex", false, patternOptions{}, ""},
+		{"prefix only", "#!scofx syntax=regex", false, patternOptions{}, ""},
+		{"unknown key", "#!scof syntax=regex colour=red", true, patternOptions{}, "f:1:21: unknown directive \"colour\""},
+		{"invalid syntax", "#!scof syntax=pcre", true, patternOptions{}, "f:1:8: invalid syntax \"pcre\""},
+		{"invalid case", "#!scof case=upper", true, patternOptions{}, "f:1:8: invalid case \"upper\""},
+		{"invalid anchor", "#!scof anchor=start", true, patternOptions{}, "f:1:8: invalid anchor \"start\""},
+		{"missing value", "#!scof regex", true, patternOptions{}, "f:1:8: invalid directive \"regex\", expected key=value"},
+		{"duplicate", "#!scof case=sensitive case=insensitive", true, patternOptions{}, "f:1:23: duplicate directive \"case\""},
+		{"limit", "#!scof limit=5", true, patternOptions{limit: 5}, ""},
+		{"limit none", "#!scof limit=none", true, patternOptions{limit: limitNone}, ""},
+		{"invalid limit", "#!scof limit=0", true, patternOptions{}, "f:1:8: invalid limit \"0\""},
+		{"stream", "#!scof stream=err", true, patternOptions{stream: streamErr}, ""},
+		{"invalid stream", "#!scof stream=stdout", true, patternOptions{}, "f:1:8: invalid stream \"stdout\""},
+		{"exclude", "#!scof exclude=true", true, patternOptions{exclude: excludeTrue}, ""},
+		{"invalid exclude", "#!scof exclude=yes", true, patternOptions{}, "f:1:8: invalid exclude \"yes\""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isDirectiveHeader(tc.line); got != tc.isHeader {
+				t.Fatalf("isDirectiveHeader(%q) = %v, want %v", tc.line, got, tc.isHeader)
+			}
+			if !tc.isHeader {
+				return
+			}
+			options, err := parseDirectiveHeader("f", tc.line)
+			if tc.wantError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantError) {
+					t.Fatalf("parseDirectiveHeader() error = %v, want prefix %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDirectiveHeader() error = %v", err)
+			}
+			if options != tc.expected {
+				t.Errorf("parseDirectiveHeader() = %+v, want %+v", options, tc.expected)
+			}
+		})
+	}
+}
+
+func Test_findInlineDirective(t *testing.T) {
+	for line, expected := range map[string]int{
+		"pattern":                     -1,
+		"pattern #!scof limit=5":      8,
+		"pattern#!scof":               7,
+		"pattern # comment #!scof":    -1,
+		"a ## b #!scof limit=1":       7,
+		"a ##!scof limit=1":           -1,
+		"pattern #!scofx":             -1,
+		"#!scof syntax=regex":         0,
+		"x\t#!scof\tcase=insensitive": 2,
+	} {
+		if got := findInlineDirective(line); got != expected {
+			t.Errorf("findInlineDirective(%q) = %d, want %d", line, got, expected)
+		}
+	}
+}
+
+func Test_readPatterns_inlineDirective(t *testing.T) {
+	input := "#!scof limit=2 case=insensitive\nA* #!scof limit=none\nb* # comment\nc* #!scof case=sensitive limit=1\nd* #!scof bogus\n"
+	_, err := readPatterns(nil, strings.NewReader(input), "f", false)
+	if err == nil || err.Error() != `f:5:11: invalid directive "bogus", expected key=value` {
+		t.Fatalf("error = %v", err)
+	}
+
+	patterns, err := readPatterns(nil, strings.NewReader(strings.TrimSuffix(input, "d* #!scof bogus\n")), "f", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []rawPattern{
+		{text: "A*", options: patternOptions{caseMode: caseInsensitive, limit: limitNone}, source: "f:2"},
+		{text: "b*", options: patternOptions{caseMode: caseInsensitive, limit: 2}, source: "f:3"},
+		{text: "c*", options: patternOptions{caseMode: caseSensitive, limit: 1}, source: "f:4"},
+	}
+	if len(patterns) != len(expected) {
+		t.Fatalf("got %+v", patterns)
+	}
+	for i := range patterns {
+		if patterns[i] != expected[i] {
+			t.Errorf("pattern %d = %+v, want %+v", i, patterns[i], expected[i])
+		}
+	}
+}
+
+func Test_readPatternFile_directiveHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	writeFile := func(name, content string) string {
+		t.Helper()
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		return filePath
+	}
+
+	t.Run("with header", func(t *testing.T) {
+		filePath := writeFile("with.txt", "\uFEFF#!scof syntax=regex anchor=none\r\nfoo\\d+\r\n# comment\r\nbar\r\n")
+		patterns, err := readPatternFile(nil, filePath, true)
+		if err != nil {
+			t.Fatalf("readPatternFile() error = %v", err)
+		}
+		expected := []rawPattern{
+			{text: `foo\d+`, options: patternOptions{syntax: syntaxRegex, anchor: anchorNone}, source: filePath + ":2"},
+			{text: `bar`, options: patternOptions{syntax: syntaxRegex, anchor: anchorNone}, source: filePath + ":4"},
+		}
+		if len(patterns) != len(expected) {
+			t.Fatalf("readPatternFile() = %+v, want %+v", patterns, expected)
+		}
+		for i := range expected {
+			if patterns[i] != expected[i] {
+				t.Errorf("pattern %d = %+v, want %+v", i, patterns[i], expected[i])
+			}
+		}
+	})
+
+	t.Run("header only", func(t *testing.T) {
+		filePath := writeFile("only.txt", "#!scof case=insensitive")
+		patterns, err := readPatternFile(nil, filePath, true)
+		if err != nil {
+			t.Fatalf("readPatternFile() error = %v", err)
+		}
+		if len(patterns) != 0 {
+			t.Errorf("expected no patterns, got %+v", patterns)
+		}
+	})
+
+	t.Run("without header", func(t *testing.T) {
+		filePath := writeFile("without.txt", "foo*\n")
+		patterns, err := readPatternFile(nil, filePath, true)
+		if err != nil {
+			t.Fatalf("readPatternFile() error = %v", err)
+		}
+		if len(patterns) != 1 || patterns[0].options != (patternOptions{}) {
+			t.Errorf("expected one pattern without options, got %+v", patterns)
+		}
+	})
+
+	t.Run("header not on the first line", func(t *testing.T) {
+		filePath := writeFile("later.txt", "foo\n#!scof syntax=regex\n")
+		patterns, err := readPatternFile(nil, filePath, false)
+		if err != nil {
+			t.Fatalf("readPatternFile() error = %v", err)
+		}
+		if len(patterns) != 1 || patterns[0].options != (patternOptions{}) {
+			t.Errorf("expected the later header to be a comment, got %+v", patterns)
+		}
+		_, err = readPatternFile(nil, filePath, true)
+		if err == nil || err.Error() != filePath+":2:1: directive header not on the first line" {
+			t.Errorf("expected a strict mode error, got %v", err)
+		}
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		filePath := writeFile("invalid.txt", "#!scof syntax=bogus\nfoo\n")
+		_, err := readPatternFile(nil, filePath, false)
+		if err == nil || !strings.HasPrefix(err.Error(), filePath+":1:8: invalid syntax") {
+			t.Errorf("expected an error, got %v", err)
+		}
+	})
+}
+
+func TestCLI_loadAndCompilePatterns_directiveHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	regexFile := filepath.Join(tmpDir, "regex.txt")
+	if err := os.WriteFile(regexFile, []byte("#!scof syntax=regex case=insensitive anchor=none\nerr(or)?\\b\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	wildcardFile := filepath.Join(tmpDir, "wildcard.txt")
+	if err := os.WriteFile(wildcardFile, []byte("warn*\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	substringFile := filepath.Join(tmpDir, "substring.txt")
+	if err := os.WriteFile(substringFile, []byte("#!scof anchor=none\nfoo.bar\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cli := &CLI{
+		rawPatterns:  []string{"raw"},
+		patternFiles: []string{regexFile, wildcardFile, substringFile},
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+	m := &matcher{patterns: cli.compiledPatterns}
+
+	for _, tc := range [...]struct {
+		line     string
+		expected int
+	}{
+		{"raw", 0},
+		{"RAW", -1},
+		{"an ERROR occurred", 1},
+		{"Err: x", 1},
+		{"errors", -1},
+		{"warning", 2},
+		{"a warning", -1},
+		{"WARNING", -1},
+		{"x foo.bar y", 3},
+		{"x fooxbar y", -1},
+	} {
+		if got := m.match([]byte(tc.line)); got != tc.expected {
+			t.Errorf("match(%q) = %d, want %d", tc.line, got, tc.expected)
+		}
+	}
+}
+
+func TestCLI_loadAndCompilePatterns_invalidRegex(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	filePath := filepath.Join(tmpDir, "regex.txt")
+	if err := os.WriteFile(filePath, []byte("#!scof syntax=regex\nok\nfoo(\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cli := &CLI{patternFiles: []string{filePath}}
+	err := cli.loadAndCompilePatterns()
+	if err == nil || !strings.HasPrefix(err.Error(), filePath+`:3: invalid regex "foo("`) {
+		t.Fatalf("expected an invalid regex error, got %v", err)
+	}
+}
+
+func Test_compilePattern_anchoredAlternation(t *testing.T) {
+	re, err := compilePattern(rawPattern{text: `a|b`, options: patternOptions{syntax: syntaxRegex}}, patternOptions{caseMode: caseSensitive, anchor: anchorLine})
+	if err != nil {
+		t.Fatalf("compilePattern() error = %v", err)
+	}
+	for _, s := range []string{"ab", "xa", "bx"} {
+		if re.MatchString(s) {
+			t.Errorf("expected %q not to match, as the alternation is anchored", s)
+		}
+	}
+	if !re.MatchString("a") || !re.MatchString("b") {
+		t.Error("expected both alternatives to match")
+	}
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = `SCOF_`
+
+const (
+	optionSourceDefault     = `default`
+	optionSourceCommandLine = `command line`
+	optionSourceEnv         = `environment`
+)
+
+// envListSeparators are the separators for options that may be specified
+// multiple times, keyed by the option's (long) name.
+var envListSeparators = map[string]string{
+	`pattern`:             "\n",
+	`pattern-file`:        string(os.PathListSeparator),
+	`preset`:              `,`,
+	`multiline`:           `,`,
+	`collapse-normalize`:  "\n",
+	`stderr-pattern`:      "\n",
+	`stderr-pattern-file`: string(os.PathListSeparator),
+}
+
+// envIgnoredOptions are options that don't make sense to set via the
+// environment, as they exit without running a command.
+var envIgnoredOptions = map[string]bool{
+	`list-presets`: true,
+	`show-options`: true,
+}
+
+// optionGroup is a flag and its aliases (flags sharing the same value).
+type optionGroup struct {
+	name    string // the longest name, used to derive envKey
+	aliases []string
+	value   flag.Value
+	envKey  string
+	source  string
+}
+
+// optionGroups returns the defined flags, grouped by value, in lexical order
+// of the (longest) name of each group.
+func (x *CLI) optionGroups() []*optionGroup {
+	var groups []*optionGroup
+	byValue := make(map[flag.Value]*optionGroup)
+	x.flagSet.VisitAll(func(f *flag.Flag) {
+		group := byValue[f.Value]
+		if group == nil {
+			group = &optionGroup{value: f.Value, source: optionSourceDefault}
+			byValue[f.Value] = group
+			groups = append(groups, group)
+		}
+		if len(f.Name) > len(group.name) {
+			if group.name != `` {
+				group.aliases = append(group.aliases, group.name)
+			}
+			group.name = f.Name
+		} else {
+			group.aliases = append(group.aliases, f.Name)
+		}
+	})
+	slices.SortFunc(groups, func(a, b *optionGroup) int {
+		return strings.Compare(a.name, b.name)
+	})
+	for _, group := range groups {
+		group.envKey = envPrefix + strings.ToUpper(strings.ReplaceAll(group.name, `-`, `_`))
+	}
+	return groups
+}
+
+// applyEnv must be called after parsing the command line, and sets each
+// option that wasn't on the command line from the environment, if present.
+// The source of each option is recorded, for printOptions.
+func (x *CLI) applyEnv() error {
+	x.options = x.optionGroups()
+
+	set := make(map[flag.Value]bool)
+	x.flagSet.Visit(func(f *flag.Flag) {
+		set[f.Value] = true
+	})
+
+	for _, group := range x.options {
+		if set[group.value] {
+			group.source = optionSourceCommandLine
+			continue
+		}
+
+		if x.LookupEnv == nil || envIgnoredOptions[group.name] {
+			continue
+		}
+
+		value, ok := x.LookupEnv(group.envKey)
+		if !ok || value == `` {
+			continue
+		}
+
+		values := []string{value}
+		if sep, ok := envListSeparators[group.name]; ok {
+			values = strings.Split(value, sep)
+		}
+
+		for _, value := range values {
+			if value == `` {
+				continue
+			}
+			if err := group.value.Set(value); err != nil {
+				return fmt.Errorf("invalid value %q for environment variable %s: %w", value, group.envKey, err)
+			}
+		}
+
+		group.source = optionSourceEnv + ` (` + group.envKey + `)`
+	}
+
+	x.warnUnknownEnv()
+
+	return nil
+}
+
+// warnUnknownEnv writes a warning for each environment variable with the
+// SCOF_ prefix that doesn't correspond to an option, as it's ignored.
+func (x *CLI) warnUnknownEnv() {
+	if x.Environ == nil {
+		return
+	}
+	known := make(map[string]bool, len(x.options))
+	for _, group := range x.options {
+		known[group.envKey] = true
+	}
+	for _, entry := range x.Environ() {
+		key, _, _ := strings.Cut(entry, `=`)
+		if strings.HasPrefix(key, envPrefix) && !known[key] {
+			_, _ = fmt.Fprintf(x.ErrOut, "Warning: ignoring unrecognized environment variable %s\n", key)
+		}
+	}
+}
+
+// printOptions writes the effective value and source of each option.
+func (x *CLI) printOptions(w io.Writer) {
+	var nameWidth, valueWidth int
+	for _, group := range x.options {
+		if envIgnoredOptions[group.name] {
+			continue
+		}
+		nameWidth = max(nameWidth, len(group.name))
+		valueWidth = max(valueWidth, len(strconv.Quote(group.value.String())))
+	}
+	for _, group := range x.options {
+		if envIgnoredOptions[group.name] {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%-*s  %-*s  %s\n", nameWidth, group.name, valueWidth, strconv.Quote(group.value.String()), group.source)
+	}
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func mapLookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestCLI_init_env(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		wantError string
+		checkFunc func(*testing.T, *CLI)
+	}{
+		{
+			name: "env defaults",
+			env: map[string]string{
+				"SCOF_ERROR_MODE":   "on-content",
+				"SCOF_INVERT_MATCH": "true",
+				"SCOF_PATTERN":      "hello*\nworld",
+				"SCOF_PRESET":       "npm-warnings,make-noise",
+			},
+			args: []string{"echo"},
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.errorMode != errorModeOnContent {
+					t.Errorf("Expected errorMode %q, got %q", errorModeOnContent, c.errorMode)
+				}
+				if !c.invertMatch {
+					t.Error("Expected invertMatch to be true")
+				}
+				if !slices.Equal(c.rawPatterns, []string{"hello*", "world"}) {
+					t.Errorf("Unexpected patterns: %q", c.rawPatterns)
+				}
+				if !slices.Equal(c.presets, []string{"npm-warnings", "make-noise"}) {
+					t.Errorf("Unexpected presets: %q", c.presets)
+				}
+			},
+		},
+		{
+			name: "command line takes precedence",
+			env: map[string]string{
+				"SCOF_ERROR_MODE": "on-content",
+				"SCOF_PATTERN":    "from-env",
+			},
+			args: []string{"-e", "no-content", "-p", "from-args", "echo"},
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.errorMode != errorModeNoContent {
+					t.Errorf("Expected errorMode %q, got %q", errorModeNoContent, c.errorMode)
+				}
+				if !slices.Equal(c.rawPatterns, []string{"from-args"}) {
+					t.Errorf("Expected command line patterns to replace env, got %q", c.rawPatterns)
+				}
+			},
+		},
+		{
+			name: "alias on command line takes precedence",
+			env:  map[string]string{"SCOF_INVERT_MATCH": "true"},
+			args: []string{"-v=false", "echo"},
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.invertMatch {
+					t.Error("Expected invertMatch to be false")
+				}
+			},
+		},
+		{
+			name: "pattern file list",
+			env:  map[string]string{"SCOF_PATTERN_FILE": "a" + string(os.PathListSeparator) + string(os.PathListSeparator) + "b"},
+			args: []string{"--list-presets"},
+			checkFunc: func(t *testing.T, c *CLI) {
+				if !slices.Equal(c.patternFiles, []string{"a", "b"}) {
+					t.Errorf("Unexpected pattern files: %q", c.patternFiles)
+				}
+			},
+		},
+		{
+			name: "empty is unset",
+			env:  map[string]string{"SCOF_ERROR_MODE": ""},
+			args: []string{"echo"},
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.errorMode != errorModeDefault {
+					t.Errorf("Expected errorMode %q, got %q", errorModeDefault, c.errorMode)
+				}
+			},
+		},
+		{
+			name:      "invalid env value",
+			env:       map[string]string{"SCOF_ERROR_MODE": "bogus"},
+			args:      []string{"echo"},
+			wantError: `invalid value "bogus" for environment variable SCOF_ERROR_MODE`,
+		},
+		{
+			name:      "invalid env bool",
+			env:       map[string]string{"SCOF_STRICT_PATTERNS": "maybe"},
+			args:      []string{"echo"},
+			wantError: `SCOF_STRICT_PATTERNS`,
+		},
+		{
+			name: "short names are not used",
+			env:  map[string]string{"SCOF_P": "hello", "SCOF_V": "true"},
+			args: []string{"echo"},
+			checkFunc: func(t *testing.T, c *CLI) {
+				if len(c.rawPatterns) != 0 || c.invertMatch {
+					t.Errorf("Expected short names to be ignored, got %q, %v", c.rawPatterns, c.invertMatch)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+			cli := &CLI{
+				Input:     strings.NewReader(""),
+				Output:    &output,
+				ErrOut:    &output,
+				LookupEnv: mapLookupEnv(tc.env),
+			}
+
+			err := cli.init(tc.args)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("init() error = %v, expected to contain %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil && err != errNoRun {
+				t.Fatalf("init() error = %v", err)
+			}
+			tc.checkFunc(t, cli)
+		})
+	}
+}
+
+func TestCLI_init_envUnrecognized(t *testing.T) {
+	// N.B. SCOF_SHOW_OPTIONS is recognized, though ignored
+	environ := []string{"SCOF_ERROR_MODE=on-content", "SCOF_INVERT=true", "SCOF_P=hello", "SCOF_SHOW_OPTIONS=true", "HOME=/home/user"}
+	env := make(map[string]string)
+	for _, entry := range environ {
+		key, value, _ := strings.Cut(entry, "=")
+		env[key] = value
+	}
+	var stderr bytes.Buffer
+	cli := &CLI{
+		Input:     strings.NewReader(""),
+		Output:    &bytes.Buffer{},
+		ErrOut:    &stderr,
+		LookupEnv: mapLookupEnv(env),
+		Environ:   func() []string { return environ },
+	}
+	if err := cli.init([]string{"echo"}); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	if cli.invertMatch || len(cli.rawPatterns) != 0 || cli.errorMode != errorModeOnContent {
+		t.Errorf("unexpected options: %v, %q, %q", cli.invertMatch, cli.rawPatterns, cli.errorMode)
+	}
+	if expected := "Warning: ignoring unrecognized environment variable SCOF_INVERT\nWarning: ignoring unrecognized environment variable SCOF_P\n"; stderr.String() != expected {
+		t.Errorf("stderr = %q, want %q", stderr.String(), expected)
+	}
+}
+
+func TestCLI_Main_showOptions(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	cli := &CLI{
+		Input:  strings.NewReader(""),
+		Output: &stdout,
+		ErrOut: &stderr,
+		LookupEnv: mapLookupEnv(map[string]string{
+			"SCOF_ERROR_MODE": "on-content",
+			"SCOF_PATTERN":    "ignored",
+		}),
+	}
+
+	if code := cli.Main([]string{"-p", "a", "--pattern", "b", "--show-options"}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	expected := map[string][]string{
+		"error-mode":   {`"on-content"`, "environment (SCOF_ERROR_MODE)"},
+		"invert-match": {`"false"`, "default"},
+		"pattern":      {`"a, b"`, "command line"},
+	}
+	var found int
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			t.Fatalf("unexpected empty line in %q", stdout.String())
+		}
+		if fields[0] == "show-options" || fields[0] == "list-presets" {
+			t.Errorf("unexpected option listed: %q", line)
+		}
+		want, ok := expected[fields[0]]
+		if !ok {
+			continue
+		}
+		found++
+		if got := strings.Join(fields[1:], " "); got != strings.Join(want, " ") {
+			t.Errorf("option %s: got %q, want %q", fields[0], got, strings.Join(want, " "))
+		}
+	}
+	if found != len(expected) {
+		t.Errorf("expected %d options to be listed, found %d in %q", len(expected), found, stdout.String())
+	}
+}
@@ -2,35 +2,224 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-func readPatternsFromFile(allRawPatterns []string, filePath string) ([]string, error) {
+// patternFileError indicates a problem with a specific position in a pattern
+// file, as reported by strict mode.
+type patternFileError struct {
+	filePath string
+	line     int
+	col      int // 1-based, in runes (each invalid byte counts as one)
+	msg      string
+}
+
+func (x *patternFileError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", x.filePath, x.line, x.col, x.msg)
+}
+
+// patternFileExt is the extension of files loaded from pattern directories.
+const patternFileExt = `.patterns`
+
+// resolvePatternFiles expands x.patternFiles, which may include directories
+// and globs, to the list of pattern files to read, in order.
+func (x *CLI) resolvePatternFiles() ([]string, error) {
+	return expandPatternFiles(x.patternFiles)
+}
+
+// expandPatternFiles implements resolvePatternFiles, for the given args.
+func expandPatternFiles(args []string) ([]string, error) {
+	var filePaths []string
+	for _, arg := range args {
+		var err error
+		filePaths, err = expandPatternFile(filePaths, arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filePaths, nil
+}
+
+// expandPatternFile appends the pattern files referred to by arg to
+// filePaths. Directories expand to the *.patterns files directly within
+// them, in lexical order, and shell-style globs expand to their matches
+// (in lexical order, also expanding directories). Paths that exist as-is are
+// never treated as globs, and paths that don't exist are returned unchanged,
+// to be reported by readPatternFile.
+func expandPatternFile(filePaths []string, arg string) ([]string, error) {
+	if _, err := os.Stat(arg); err != nil && hasGlobMeta(arg) {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern file glob %q: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no pattern files match glob %q", arg)
+		}
+		for _, match := range matches {
+			filePaths, err = expandPatternDir(filePaths, match)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return filePaths, nil
+	}
+	return expandPatternDir(filePaths, arg)
+}
+
+// expandPatternDir appends filePath to filePaths, or, if it is a directory,
+// the *.patterns files directly within it.
+func expandPatternDir(filePaths []string, filePath string) ([]string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil || !info.IsDir() {
+		return append(filePaths, filePath), nil
+	}
+	entries, err := os.ReadDir(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pattern directory %q: %w", filePath, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == patternFileExt {
+			filePaths = append(filePaths, filepath.Join(filePath, entry.Name()))
+		}
+	}
+	return filePaths, nil
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// readPatternFile reads patterns from the given file, appending them to
+// allRawPatterns. A leading UTF-8 BOM and CRLF line endings are always
+// accepted. In strict mode, anything else that is likely to cause a pattern
+// to silently not match (e.g. invalid UTF-8, tabs) is rejected. If the first
+// line is a directive header, it sets the options for every pattern in the
+// file.
+func readPatternFile(allRawPatterns []rawPattern, filePath string, strict bool) ([]rawPattern, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open pattern file %q: %w", filePath, err)
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	allRawPatterns, err = readPatterns(allRawPatterns, file, filePath, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close pattern file %q: %w", filePath, err)
+	}
+
+	return allRawPatterns, nil
+}
+
+// readPatterns implements readPatternFile, for any reader, where filePath is
+// used to identify the source in errors.
+func readPatterns(allRawPatterns []rawPattern, r io.Reader, filePath string, strict bool) ([]rawPattern, error) {
+	// N.B. unlike bufio.Scanner, bufio.Reader has no limit on the line length
+	reader := bufio.NewReader(r)
+
+	var options patternOptions
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read pattern file %q: %w", filePath, err)
+		}
+		if line == `` && err != nil {
+			break
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+
+		if strict {
+			if col, msg := checkStrictPatternLine(line); msg != `` {
+				return nil, &patternFileError{filePath: filePath, line: lineNumber, col: col, msg: msg}
+			}
+		}
+
+		if isDirectiveHeader(line) {
+			if lineNumber == 1 {
+				var headerErr error
+				options, headerErr = parseDirectiveHeader(filePath, line)
+				if headerErr != nil {
+					return nil, headerErr
+				}
+				if err != nil {
+					break
+				}
+				continue
+			}
+			if strict {
+				return nil, &patternFileError{filePath: filePath, line: lineNumber, col: 1, msg: "directive header not on the first line"}
+			}
+		}
+
+		entryOptions := options
+		if i := findInlineDirective(line); i > 0 {
+			inlineOptions, inlineErr := parseDirectives(filePath, lineNumber, line, i)
+			if inlineErr != nil {
+				return nil, inlineErr
+			}
+			entryOptions = inlineOptions.or(options)
+		}
+
+		if line := stripCommentFromLine(line); line != `` {
+			allRawPatterns = append(allRawPatterns, rawPattern{
+				text:    line,
+				options: entryOptions,
+				source:  fmt.Sprintf("%s:%d", filePath, lineNumber),
+			})
+		}
 
-	for scanner.Scan() {
-		if line := stripCommentFromLine(scanner.Text()); line != `` {
-			allRawPatterns = append(allRawPatterns, line)
+		if err != nil {
+			break
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read pattern file %q: %w", filePath, err)
+	return allRawPatterns, nil
+}
+
+// checkStrictPatternLine validates a line from a pattern file (terminator
+// excluded), returning the 1-based column and description of the first
+// problem found, or an empty message.
+func checkStrictPatternLine(line string) (int, string) {
+	col := 1
+	for i := 0; i < len(line); col++ {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			return col, "invalid UTF-8 encoding"
+		case r == '\t':
+			return col, "tab character"
+		case r == '\r':
+			return col, "carriage return not followed by a newline"
+		case r == '\uFEFF':
+			return col, "byte order mark not at the start of the file"
+		case unicode.IsControl(r):
+			return col, fmt.Sprintf("control character %U", r)
+		}
+		i += size
 	}
 
-	if err := file.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close pattern file %q: %w", filePath, err)
+	// N.B. whitespace preceding a comment is already ignored
+	if trimmed := stripCommentFromLine(line); trimmed != `` && strings.TrimRightFunc(trimmed, unicode.IsSpace) != trimmed {
+		return utf8.RuneCountInString(strings.TrimRightFunc(line, unicode.IsSpace)) + 1, "trailing whitespace"
 	}
 
-	return allRawPatterns, nil
+	return 0, ``
 }
 
 func stripCommentFromLine(line string) string {
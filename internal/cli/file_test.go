@@ -1,16 +1,18 @@
 package cli
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
 	"slices"
+	"strings"
 	"testing"
 )
 
-func Test_readPatternsFromFile_errorCases(t *testing.T) {
+func Test_readPatternFile_errorCases(t *testing.T) {
 	t.Run("non-existent file", func(t *testing.T) {
-		_, err := readPatternsFromFile(nil, "/non/existent/file/path")
+		_, err := readPatternFile(nil, "/non/existent/file/path", false)
 		if err == nil {
 			t.Error("Expected error for non-existent file, got nil")
 		}
@@ -40,7 +42,7 @@ func Test_readPatternsFromFile_errorCases(t *testing.T) {
 			t.Fatalf("Failed to change file permissions: %v", err)
 		}
 
-		_, err = readPatternsFromFile(nil, tmpFile.Name())
+		_, err = readPatternFile(nil, tmpFile.Name(), false)
 		if err == nil {
 			// if no error, possibly running as root/admin
 			t.Skip("Test skipped - no permission error (possibly running as root/admin)")
@@ -93,7 +95,7 @@ func Test_stripCommentFromLine_extendedCases(t *testing.T) {
 	}
 }
 
-func Test_readPatternsFromFile_success(t *testing.T) {
+func Test_readPatternFile_success(t *testing.T) {
 	tmpFile, err := os.CreateTemp("", "patterns-*.txt")
 	if err != nil {
 		t.Fatalf("Failed to create temporary file: %v", err)
@@ -108,9 +110,9 @@ func Test_readPatternsFromFile_success(t *testing.T) {
 		t.Fatalf("Failed to close temporary file: %v", err)
 	}
 
-	patterns, err := readPatternsFromFile(nil, tmpFile.Name())
+	patterns, err := readPatternFile(nil, tmpFile.Name(), false)
 	if err != nil {
-		t.Fatalf("readPatternsFromFile returned error: %v", err)
+		t.Fatalf("readPatternFile returned error: %v", err)
 	}
 
 	// verify patterns, expectations adjusted for implementation
@@ -119,25 +121,25 @@ func Test_readPatternsFromFile_success(t *testing.T) {
 		t.Errorf("Expected %d patterns, got %d", len(expected), len(patterns))
 	}
 
-	for i, p := range patterns {
+	for i, p := range patternTexts(patterns) {
 		if i < len(expected) && p != expected[i] {
 			t.Errorf("Pattern %d: expected %q, got %q", i, expected[i], p)
 		}
 	}
 
-	initialPatterns := []string{"initial1", "initial2"}
-	patterns, err = readPatternsFromFile(initialPatterns, tmpFile.Name())
+	initialPatterns := []rawPattern{{text: "initial1"}, {text: "initial2"}}
+	patterns, err = readPatternFile(initialPatterns, tmpFile.Name(), false)
 	if err != nil {
-		t.Fatalf("readPatternsFromFile with initial patterns returned error: %v", err)
+		t.Fatalf("readPatternFile with initial patterns returned error: %v", err)
 	}
 
-	expected = append(initialPatterns, expected...)
+	expected = append([]string{"initial1", "initial2"}, expected...)
 	if len(patterns) != len(expected) {
 		t.Errorf("Expected %d patterns with initial values, got %d", len(expected), len(patterns))
 	}
 }
 
-func Test_readPatternsFromFile_fileError(t *testing.T) {
+func Test_readPatternFile_fileError(t *testing.T) {
 	// create a temporary directory for the test
 	tempDir, err := os.MkdirTemp("", "test-dir")
 	if err != nil {
@@ -151,7 +153,7 @@ func Test_readPatternsFromFile_fileError(t *testing.T) {
 
 	// attempt to read from a file in a non-existent directory
 	nonExistentFilePath := tempDir + "/non-existent-file.txt"
-	_, err = readPatternsFromFile(nil, nonExistentFilePath)
+	_, err = readPatternFile(nil, nonExistentFilePath, false)
 	if err == nil {
 		t.Error("Expected error for non-existent file, got nil")
 	}
@@ -200,10 +202,10 @@ func Test_stripCommentFromLine_completePatterns(t *testing.T) {
 	}
 }
 
-func Test_readPatternsFromFile_Complete(t *testing.T) {
+func Test_readPatternFile_Complete(t *testing.T) {
 	// test non-existent file
 	t.Run("non-existent file", func(t *testing.T) {
-		_, err := readPatternsFromFile(nil, "/path/to/nonexistent/file")
+		_, err := readPatternFile(nil, "/path/to/nonexistent/file", false)
 		if err == nil {
 			t.Error("Expected error for non-existent file, got nil")
 		}
@@ -225,9 +227,9 @@ func Test_readPatternsFromFile_Complete(t *testing.T) {
 			t.Fatalf("Failed to close temporary file: %v", err)
 		}
 
-		patterns, err := readPatternsFromFile(nil, tmpFile.Name())
+		patterns, err := readPatternFile(nil, tmpFile.Name(), false)
 		if err != nil {
-			t.Fatalf("readPatternsFromFile returned error: %v", err)
+			t.Fatalf("readPatternFile returned error: %v", err)
 		}
 
 		expected := []string{"pattern1", "pattern2", "pattern3 # not a comment"}
@@ -235,7 +237,7 @@ func Test_readPatternsFromFile_Complete(t *testing.T) {
 			t.Errorf("Expected %d patterns, got %d", len(expected), len(patterns))
 		}
 
-		for i, p := range patterns {
+		for i, p := range patternTexts(patterns) {
 			if i < len(expected) && p != expected[i] {
 				t.Errorf("Pattern %d: expected %q, got %q", i, expected[i], p)
 			}
@@ -258,10 +260,10 @@ func Test_readPatternsFromFile_Complete(t *testing.T) {
 			t.Fatalf("Failed to close temporary file: %v", err)
 		}
 
-		initialPatterns := []string{"initial1", "initial2"}
-		patterns, err := readPatternsFromFile(initialPatterns, tmpFile.Name())
+		initialPatterns := []rawPattern{{text: "initial1"}, {text: "initial2"}}
+		patterns, err := readPatternFile(initialPatterns, tmpFile.Name(), false)
 		if err != nil {
-			t.Fatalf("readPatternsFromFile with initial patterns returned error: %v", err)
+			t.Fatalf("readPatternFile with initial patterns returned error: %v", err)
 		}
 
 		// verify patterns are appended
@@ -270,7 +272,7 @@ func Test_readPatternsFromFile_Complete(t *testing.T) {
 			t.Errorf("Expected %d patterns with initial values, got %d", len(expected), len(patterns))
 		}
 
-		for i, p := range patterns {
+		for i, p := range patternTexts(patterns) {
 			if i < len(expected) && p != expected[i] {
 				t.Errorf("Pattern %d: expected %q, got %q", i, expected[i], p)
 			}
@@ -290,9 +292,9 @@ func Test_readPatternsFromFile_Complete(t *testing.T) {
 			t.Fatalf("Failed to close temporary file: %v", err)
 		}
 
-		patterns, err := readPatternsFromFile(nil, tmpFile.Name())
+		patterns, err := readPatternFile(nil, tmpFile.Name(), false)
 		if err != nil {
-			t.Fatalf("readPatternsFromFile with empty file returned error: %v", err)
+			t.Fatalf("readPatternFile with empty file returned error: %v", err)
 		}
 
 		if len(patterns) != 0 {
@@ -317,9 +319,9 @@ func Test_readPatternsFromFile_Complete(t *testing.T) {
 			t.Fatalf("Failed to close temporary file: %v", err)
 		}
 
-		patterns, err := readPatternsFromFile(nil, tmpFile.Name())
+		patterns, err := readPatternFile(nil, tmpFile.Name(), false)
 		if err != nil {
-			t.Fatalf("readPatternsFromFile with comments-only file returned error: %v", err)
+			t.Fatalf("readPatternFile with comments-only file returned error: %v", err)
 		}
 
 		if len(patterns) != 0 {
@@ -358,9 +360,9 @@ func Test_fileReadPatterns_closeError(t *testing.T) {
 	err = file.Close()
 	if err != nil {
 		// if an error occurred, ensure our implementation handles it
-		_, err := readPatternsFromFile(nil, testFile)
+		_, err := readPatternFile(nil, testFile, false)
 		if err != nil {
-			t.Fatalf("readPatternsFromFile failed with valid file: %v", err)
+			t.Fatalf("readPatternFile failed with valid file: %v", err)
 		}
 	} else {
 		t.Skip("Platform doesn't generate error on closing deleted file, skipping close error test")
@@ -381,9 +383,9 @@ func Test_fileReadPatterns_additionalCases(t *testing.T) {
 		t.Fatalf("Failed to create empty file: %v", err)
 	}
 
-	patterns, err := readPatternsFromFile(nil, emptyFile)
+	patterns, err := readPatternFile(nil, emptyFile, false)
 	if err != nil {
-		t.Errorf("readPatternsFromFile failed with empty file: %v", err)
+		t.Errorf("readPatternFile failed with empty file: %v", err)
 	}
 	if len(patterns) != 0 {
 		t.Errorf("Expected 0 patterns from empty file, got %d", len(patterns))
@@ -395,12 +397,12 @@ func Test_fileReadPatterns_additionalCases(t *testing.T) {
 	if err := os.WriteFile(commentsFile, []byte(content), 0644); err != nil {
 		t.Fatalf("Failed to create comments file: %v", err)
 	}
-	patterns, err = readPatternsFromFile(nil, commentsFile)
+	patterns, err = readPatternFile(nil, commentsFile, false)
 	if err != nil {
-		t.Errorf("readPatternsFromFile failed with comments-only file: %v", err)
+		t.Errorf("readPatternFile failed with comments-only file: %v", err)
 	}
 	// empty lines or lines with only comments should be filtered out. stripCommentFromLine returns an empty string for these, and they are skipped.
-	if !slices.Equal(patterns, []string{"   "}) {
+	if !slices.Equal(patternTexts(patterns), []string{"   "}) {
 		t.Errorf("Expected 1 pattern containing the whitespace but got %d: %v", len(patterns), patterns)
 	}
 
@@ -409,9 +411,9 @@ func Test_fileReadPatterns_additionalCases(t *testing.T) {
 	if err := os.WriteFile(commentsFile, []byte(content), 0644); err != nil {
 		t.Fatalf("Failed to create comments file: %v", err)
 	}
-	patterns, err = readPatternsFromFile(nil, commentsFile)
+	patterns, err = readPatternFile(nil, commentsFile, false)
 	if err != nil {
-		t.Errorf("readPatternsFromFile failed with comments-only file: %v", err)
+		t.Errorf("readPatternFile failed with comments-only file: %v", err)
 	}
 	// empty lines or lines with only comments should be filtered out. stripCommentFromLine returns an empty string for these, and they are skipped.
 	if len(patterns) != 0 {
@@ -435,9 +437,9 @@ pattern6#No space
 		t.Fatalf("Failed to create mixed file: %v", err)
 	}
 
-	patterns, err = readPatternsFromFile(nil, mixedFile)
+	patterns, err = readPatternFile(nil, mixedFile, false)
 	if err != nil {
-		t.Errorf("readPatternsFromFile failed with mixed file: %v", err)
+		t.Errorf("readPatternFile failed with mixed file: %v", err)
 	}
 
 	// adjust expectations to match actual behavior of stripcommentfromline
@@ -456,14 +458,14 @@ pattern6#No space
 		return
 	}
 
-	for i, p := range patterns {
+	for i, p := range patternTexts(patterns) {
 		if p != expected[i] {
 			t.Errorf("Pattern %d mismatch: expected %q, got %q", i, expected[i], p)
 		}
 	}
 }
 
-func Test_readPatternsFromFile_scannerError(t *testing.T) {
+func Test_readPatternFile_scannerError(t *testing.T) {
 	// This is a focused test for scanner errors. Since forcing a scanner error
 	// with a real file is hard, we test other reliable error paths.
 
@@ -475,8 +477,193 @@ func Test_readPatternsFromFile_scannerError(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 
 	// attempt to read patterns from a directory
-	_, err = readPatternsFromFile(nil, tmpDir)
+	_, err = readPatternFile(nil, tmpDir, false)
 	if err == nil {
 		t.Error("Expected error when reading patterns from a directory, got nil")
 	}
 }
+
+func patternTexts(patterns []rawPattern) []string {
+	texts := make([]string, len(patterns))
+	for i, p := range patterns {
+		texts[i] = p.text
+	}
+	return texts
+}
+
+func Test_readPatternFile_encoding(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	longPattern := strings.Repeat("x", 100*1024) + "*"
+
+	for _, tc := range [...]struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{"bom", "\uFEFFpattern1\npattern2\n", []string{"pattern1", "pattern2"}},
+		{"crlf", "pattern1\r\npattern2 # comment\r\npattern3", []string{"pattern1", "pattern2", "pattern3"}},
+		{"crlf no final newline", "pattern1\r\npattern2\r", []string{"pattern1", "pattern2"}},
+		{"bom and crlf", "\uFEFF# comment\r\npattern1\r\n", []string{"pattern1"}},
+		{"bom only stripped at start", "pattern1\n\uFEFFpattern2\n", []string{"pattern1", "\uFEFFpattern2"}},
+		{"longer than scanner limit", "pattern1\n" + longPattern + "\n", []string{"pattern1", longPattern}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(tmpDir, strings.ReplaceAll(tc.name, " ", "-")+".txt")
+			if err := os.WriteFile(filePath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("Failed to write pattern file: %v", err)
+			}
+			for _, strict := range [...]bool{false, true} {
+				if strict && tc.name == "bom only stripped at start" {
+					continue
+				}
+				patterns, err := readPatternFile(nil, filePath, strict)
+				texts := patternTexts(patterns)
+				if err != nil {
+					t.Fatalf("readPatternFile(strict=%v) error = %v", strict, err)
+				}
+				if !slices.Equal(texts, tc.expected) {
+					t.Errorf("readPatternFile(strict=%v) = %q, want %q", strict, texts, tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func Test_readPatternFile_strict(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, tc := range [...]struct {
+		name     string
+		content  string
+		expected string // suffix of the error, after the file path
+	}{
+		{"tab", "ok\nfoo\tbar\n", ":2:4: tab character"},
+		{"invalid utf-8", "ok\nhé\xffllo\n", ":2:3: invalid UTF-8 encoding"},
+		{"lone carriage return", "foo\rbar\n", ":1:4: carriage return not followed by a newline"},
+		{"nul", "ok\nok\nfoo\x00\n", ":3:4: control character U+0000"},
+		{"bom not at start", "ok\n\uFEFFok\n", ":2:1: byte order mark not at the start of the file"},
+		{"trailing whitespace", "ok\nfoo  \n", ":2:4: trailing whitespace"},
+		{"whitespace only", "ok\n   \n", ":2:1: trailing whitespace"},
+		{"tab in comment", "ok # a\tcomment\n", ":1:7: tab character"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(tmpDir, strings.ReplaceAll(tc.name, " ", "-")+".txt")
+			if err := os.WriteFile(filePath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("Failed to write pattern file: %v", err)
+			}
+
+			if _, err := readPatternFile(nil, filePath, false); err != nil {
+				t.Errorf("non-strict readPatternFile error = %v", err)
+			}
+
+			_, err := readPatternFile(nil, filePath, true)
+			var fileErr *patternFileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("expected a *patternFileError, got %v", err)
+			}
+			if got, want := err.Error(), filePath+tc.expected; got != want {
+				t.Errorf("error = %q, want %q", got, want)
+			}
+		})
+	}
+
+	t.Run("whitespace before comment", func(t *testing.T) {
+		filePath := filepath.Join(tmpDir, "comment.txt")
+		if err := os.WriteFile(filePath, []byte("foo   # comment\n  bar ## baz\n"), 0644); err != nil {
+			t.Fatalf("Failed to write pattern file: %v", err)
+		}
+		patterns, err := readPatternFile(nil, filePath, true)
+		if err != nil {
+			t.Fatalf("readPatternFile error = %v", err)
+		}
+		if texts, expected := patternTexts(patterns), []string{"foo", "  bar # baz"}; !slices.Equal(texts, expected) {
+			t.Errorf("patterns = %q, want %q", texts, expected)
+		}
+	})
+}
+
+func TestCLI_resolvePatternFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	writeFile := func(name, content string) string {
+		t.Helper()
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		return filePath
+	}
+
+	confD := filepath.Join(tmpDir, "conf.d")
+	b := writeFile("conf.d/20-b.patterns", "b\n")
+	a := writeFile("conf.d/10-a.patterns", "a\n")
+	writeFile("conf.d/README.md", "not patterns\n")
+	writeFile("conf.d/nested/30-c.patterns", "c\n")
+	single := writeFile("single.txt", "single\n")
+	globA := writeFile("glob/x-1.txt", "x1\n")
+	globB := writeFile("glob/x-2.txt", "x2\n")
+	literal := writeFile("literal[1].txt", "literal\n")
+
+	for _, tc := range [...]struct {
+		name      string
+		args      []string
+		expected  []string
+		wantError string
+	}{
+		{"file", []string{single}, []string{single}, ""},
+		{"directory", []string{confD}, []string{a, b}, ""},
+		{"glob", []string{filepath.Join(tmpDir, "glob", "x-*.txt")}, []string{globA, globB}, ""},
+		{"glob matching directory", []string{filepath.Join(tmpDir, "conf.?")}, []string{a, b}, ""},
+		{"order preserved", []string{single, confD, single}, []string{single, a, b, single}, ""},
+		{"literal path with meta characters", []string{literal}, []string{literal}, ""},
+		{"missing file is passed through", []string{filepath.Join(tmpDir, "missing.txt")}, []string{filepath.Join(tmpDir, "missing.txt")}, ""},
+		{"glob without matches", []string{filepath.Join(tmpDir, "nope-*.txt")}, nil, "no pattern files match glob"},
+		{"invalid glob", []string{filepath.Join(tmpDir, "[-*.txt")}, nil, "invalid pattern file glob"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cli := &CLI{patternFiles: tc.args}
+			filePaths, err := cli.resolvePatternFiles()
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("resolvePatternFiles() error = %v, expected to contain %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolvePatternFiles() error = %v", err)
+			}
+			if !slices.Equal(filePaths, tc.expected) {
+				t.Errorf("resolvePatternFiles() = %q, want %q", filePaths, tc.expected)
+			}
+		})
+	}
+
+	t.Run("errors name the specific file", func(t *testing.T) {
+		bad := writeFile("strict.d/10-bad.patterns", "ok\nbad\t\n")
+		cli := &CLI{patternFiles: []string{filepath.Join(tmpDir, "strict.d")}, strictPatterns: true}
+		err := cli.loadAndCompilePatterns()
+		if err == nil || !strings.HasPrefix(err.Error(), bad+":2:4:") {
+			t.Fatalf("expected an error naming %q, got %v", bad, err)
+		}
+	})
+
+	t.Run("patterns loaded in order", func(t *testing.T) {
+		cli := &CLI{patternFiles: []string{confD, single}}
+		if err := cli.loadAndCompilePatterns(); err != nil {
+			t.Fatalf("loadAndCompilePatterns() error = %v", err)
+		}
+		m := &matcher{patterns: cli.compiledPatterns}
+		for i, line := range []string{"a", "b", "single"} {
+			if got := m.match([]byte(line)); got != i {
+				t.Errorf("match(%q) = %d, want %d", line, got, i)
+			}
+		}
+		if m.match([]byte("c")) != -1 {
+			t.Error("expected nested directories to be ignored")
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// lineFilter keeps or suppresses the lines read from the command, writing
+// the kept lines, exactly as read (other than any prefix), along with any
+// context lines, and notices (e.g. of dropped lines), applying the limits,
+// see CLI.run.
+type lineFilter struct {
+	x        *CLI
+	binary   bool      // only a summary is written, see --binary
+	output   io.Writer // the (possibly buffered) output
+	errOut   io.Writer
+	rejected io.Writer // nil unless --rejected
+	prefixer *linePrefixer
+
+	// N.B. kept lines are written via out, which may be rate limited, and
+	// anything else via other, which ends any run of repeated lines
+	limiter     *rateLimiter
+	out         io.Writer
+	collapser   *repeatCollapser
+	other       io.Writer
+	surrounding *contextLines
+
+	// N.B. per-pattern limits don't apply to inverted matches
+	records       *recordGrouper
+	budgets       patternBudgets
+	recordMatcher *matcher // of the first matched line of the record
+	recordIndex   int
+
+	content bool
+	kept    int // the kept lines (or records), for --max-count
+}
+
+// lineWriter is implemented by writers which may drop lines, and so need
+// each line as read (e.g. to reject it), as well as formatted, i.e.
+// rateLimiter, and writers wrapping it.
+type lineWriter interface {
+	writeLine(p, line []byte)
+}
+
+// writeLine writes p, a line as formatted, to w, passing line, as read, if
+// w is a lineWriter.
+func writeLine(w io.Writer, p, line []byte) {
+	if lw, ok := w.(lineWriter); ok {
+		lw.writeLine(p, line)
+	} else {
+		_, _ = w.Write(p)
+	}
+}
+
+// newLineFilter returns a lineFilter, writing to output, where prefixer and
+// rejected may be nil.
+func (x *CLI) newLineFilter(output, errOut, rejected io.Writer, prefixer *linePrefixer, binary bool) *lineFilter {
+	f := &lineFilter{
+		x:           x,
+		binary:      binary,
+		output:      output,
+		errOut:      errOut,
+		rejected:    rejected,
+		prefixer:    prefixer,
+		out:         output,
+		recordIndex: -1,
+	}
+
+	f.limiter = x.newRateLimiter(output, errOut, rejected)
+	if f.limiter != nil {
+		f.out = f.limiter
+	}
+
+	f.other = f.out
+	if !binary {
+		f.collapser = x.newRepeatCollapser(f.out)
+	}
+	if f.collapser != nil {
+		f.other = f.collapser
+	}
+
+	// N.B. context lines are not written for binary output
+	if !binary {
+		var reject func(line []byte, info lineInfo)
+		if rejected != nil {
+			reject = func(line []byte, _ lineInfo) { f.reject(line) }
+		}
+		f.surrounding = x.newContextLines(f.other, func(line []byte, info lineInfo) {
+			f.write(f.other, line, info, '-')
+		}, reject)
+	}
+
+	if len(x.multiline) != 0 {
+		recognizers, err := newRecordRecognizers(x.multiline)
+		if err != nil {
+			panic(err) // validated by init
+		}
+		f.records = &recordGrouper{recognizers: recognizers}
+	}
+
+	return f
+}
+
+// write writes a line, prefixed if necessary, where sep follows the line
+// number, see linePrefixer.appendPrefix.
+func (f *lineFilter) write(w io.Writer, line []byte, info lineInfo, sep byte) {
+	p := line
+	if f.prefixer != nil {
+		p = f.prefixer.format(line, info, sep)
+	}
+	writeLine(w, p, line)
+}
+
+// writeLong writes a long line, like write, though the remainder is copied
+// from reader, without buffering it, so it's written in multiple calls.
+func (f *lineFilter) writeLong(w io.Writer, text []byte, info lineInfo, reader *lineReader) {
+	if f.prefixer != nil {
+		_, _ = w.Write(f.prefixer.appendPrefix(nil, info, ':'))
+	}
+	_, _ = w.Write(text)
+	_, _ = reader.copyRest(w)
+	if f.prefixer != nil {
+		_, _ = w.Write(f.prefixer.appendSuffix(nil, info))
+	}
+	_, _ = w.Write(reader.terminator())
+}
+
+// keep writes a kept line, or, for binary output, a single notice. If long
+// is set, line is the start of a long line, the remainder of which must be
+// read from long.
+func (f *lineFilter) keep(line []byte, info lineInfo, long *lineReader) {
+	switch {
+	case f.binary:
+		if long != nil {
+			_, _ = long.discardRest()
+		}
+		if !f.content {
+			_, _ = fmt.Fprintln(f.out, "Binary output matches")
+		}
+
+	case long != nil:
+		// N.B. long lines are never repeated, and are written in multiple
+		// calls, so they can't be rate limited (or retained) via out
+		if f.collapser != nil {
+			f.collapser.reset()
+		}
+		if f.limiter == nil || f.limiter.allow() {
+			f.writeLong(f.output, line, info, long)
+		} else {
+			f.rejectLong(line, long)
+		}
+
+	case f.collapser != nil && f.collapser.repeated(line):
+		// counted, to be summarized, so it's neither written nor rejected
+
+	default:
+		f.write(f.out, line, info, ':')
+	}
+	f.content = true
+}
+
+// reject writes a line that wasn't kept, exactly as read, to --rejected, if
+// enabled.
+func (f *lineFilter) reject(line []byte) {
+	if f.rejected != nil {
+		_, _ = f.rejected.Write(line)
+	}
+}
+
+// rejectLong rejects a long line, starting with text, the remainder of
+// which is read from reader.
+func (f *lineFilter) rejectLong(text []byte, reader *lineReader) {
+	if f.rejected == nil {
+		_, _ = reader.discardRest()
+		return
+	}
+	f.reject(text)
+	_, _ = reader.copyRest(f.rejected)
+	f.reject(reader.terminator())
+}
+
+// filter keeps or suppresses a line, which is written exactly as read,
+// including the terminator, returning true if it was kept. Suppressed lines
+// are rejected, unless (or until) they may not be written as context.
+func (f *lineFilter) filter(line []byte, info lineInfo, matched bool) bool {
+	if f.x.invertMatch != matched {
+		if f.surrounding != nil {
+			f.surrounding.kept()
+		}
+		f.keep(line, info, nil)
+		return true
+	}
+	if f.surrounding != nil {
+		f.surrounding.suppressed(line, info)
+	} else {
+		f.reject(line)
+	}
+	return false
+}
+
+// limited returns true once --max-count is reached.
+func (f *lineFilter) limited() bool {
+	return f.x.maxCount > 0 && f.kept >= f.x.maxCount
+}
+
+// flushRecord keeps or suppresses the current multi-line record, if any.
+func (f *lineFilter) flushRecord() {
+	if f.records == nil || f.records.n == 0 {
+		return
+	}
+	defer func() {
+		f.recordMatcher, f.recordIndex = nil, -1
+	}()
+	if f.limited() {
+		if f.surrounding != nil {
+			f.surrounding.flush()
+		}
+		f.records.flush(func(line []byte, _ lineInfo, _ bool) { f.reject(line) })
+		return
+	}
+	if !f.x.invertMatch && f.recordIndex != -1 && !f.budgets.allow(f.recordMatcher, f.recordIndex, f.records.n) {
+		if f.surrounding != nil {
+			f.surrounding.dropped()
+		}
+		f.records.flush(func(line []byte, _ lineInfo, _ bool) { f.reject(line) })
+		return
+	}
+	if f.x.invertMatch != f.records.matched {
+		f.kept++
+	}
+	f.records.flush(func(line []byte, info lineInfo, matched bool) { f.filter(line, info, matched) })
+}
+
+// line keeps or suppresses a line, per the long line policy, and the limits,
+// or adds it to the current multi-line record.
+func (f *lineFilter) line(l *scannedLine) {
+	info := l.info
+
+	if l.long {
+		switch f.x.longLinePolicy {
+		case longLinePass:
+			f.flushRecord()
+			if f.surrounding != nil {
+				f.surrounding.kept()
+			}
+			f.keep(l.text, info, l.reader)
+			f.kept++
+			return
+
+		case longLineDrop:
+			f.flushRecord()
+			if f.surrounding != nil {
+				f.surrounding.dropped()
+			}
+			rest := io.Discard
+			if f.rejected != nil {
+				rest = f.rejected
+				f.reject(l.text)
+			}
+			n, _ := l.reader.copyRest(rest)
+			f.reject(l.reader.terminator())
+			_, _ = fmt.Fprintf(f.errOut, "Warning: dropped line %d (%d bytes), exceeding --max-line-length\n", info.number, int64(len(l.text))+n)
+			return
+		}
+	}
+
+	m, index := l.m, l.index
+
+	// N.B. matched is inverted by -v, so excluded lines are never kept, and,
+	// if every pattern is excluding, any other line is, see matcher.excluded
+	matched := index != -1
+	switch {
+	case l.excluded:
+		index, matched = -1, f.x.invertMatch
+	case m.excludeOnly:
+		matched = !f.x.invertMatch
+	}
+
+	if f.records == nil {
+		allowed := index == -1 || f.x.invertMatch || f.budgets.allow(m, index, 1)
+		if l.unread() {
+			// N.B. truncated, but left unread, as it may be rejected in full
+			f.truncate(l, allowed && f.x.invertMatch != matched, allowed)
+			return
+		}
+		if !allowed {
+			if f.surrounding != nil {
+				f.surrounding.dropped()
+			}
+			f.reject(l.line)
+			return
+		}
+		if f.filter(l.line, info, matched) {
+			f.kept++
+		}
+		return
+	}
+
+	if f.records.starts(l.text) {
+		f.flushRecord()
+	}
+	if index != -1 && f.recordIndex == -1 {
+		f.recordMatcher, f.recordIndex = m, index
+	}
+	if f.records.add(l.line, info, matched) {
+		f.flushRecord()
+	}
+}
+
+// truncate keeps or suppresses a truncated line, the remainder of which was
+// left unread, so the line may be rejected in full, see lineScanner. As the
+// remainder can't be retained, a line that isn't kept is only written as
+// context if it follows a kept line, and is otherwise rejected, where allowed
+// is false if it was dropped due to the per-pattern limit.
+func (f *lineFilter) truncate(l *scannedLine, kept, allowed bool) {
+	switch {
+	case kept:
+		if f.surrounding != nil {
+			f.surrounding.kept()
+		}
+		f.keepTruncated(l)
+		f.kept++
+
+	case allowed && f.surrounding != nil && f.surrounding.following():
+		_, _ = l.reader.discardRest()
+		f.surrounding.suppressed(l.reader.line(), l.info)
+
+	default:
+		if f.surrounding != nil {
+			f.surrounding.dropped()
+		}
+		f.rejectLong(l.text, l.reader)
+	}
+}
+
+// keepTruncated keeps a truncated line, see truncate. Like long lines that
+// are passed through, the rate limit applies prior to reading the remainder,
+// and the line is rejected in full, rather than retained, if dropped.
+func (f *lineFilter) keepTruncated(l *scannedLine) {
+	if !f.binary && f.limiter != nil && !f.limiter.allow() {
+		if f.collapser != nil {
+			f.collapser.reset()
+		}
+		f.rejectLong(l.text, l.reader)
+		f.content = true
+		return
+	}
+	_, _ = l.reader.discardRest()
+	// N.B. the line, as truncated, including the terminator
+	line := l.reader.line()
+	if f.binary || f.limiter == nil {
+		f.keep(line, l.info, nil)
+		return
+	}
+	// N.B. already allowed, so it's written directly
+	if f.collapser == nil || !f.collapser.repeated(line) {
+		f.write(f.output, line, l.info, ':')
+	}
+	f.content = true
+}
+
+// drain rejects the rest of the lines from source, in order, once
+// --max-count is reached.
+func (f *lineFilter) drain(source lineSource) {
+	f.flushRecord()
+	if f.surrounding != nil {
+		f.surrounding.flush()
+	}
+	if f.rejected != nil {
+		source.drain(f.rejected)
+	} else {
+		source.drain(io.Discard)
+	}
+}
+
+// finish flushes the current multi-line record, if any, and writes the
+// remaining notices, once there are no more lines.
+func (f *lineFilter) finish() {
+	f.flushRecord()
+	if f.surrounding != nil {
+		f.surrounding.flush()
+	}
+	if f.limiter != nil {
+		f.limiter.flush()
+	}
+	f.budgets.report(f.other, f.x.recordTerminator())
+	if f.collapser != nil {
+		f.collapser.flush()
+	}
+}
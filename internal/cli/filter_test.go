@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_lineFilter_longLinePass(t *testing.T) {
+	x := &CLI{
+		maxLineLength:   4,
+		longLinePolicy:  longLinePass,
+		lineNumbers:     true,
+		collapseRepeats: true,
+		maxCount:        4,
+	}
+	var output, errOut bytes.Buffer
+	f := x.newLineFilter(&output, &errOut, nil, x.newLinePrefixer(time.Now()), false)
+
+	reader := newLineReader(strings.NewReader("a\na\nlong line\na\nb\n"), x.maxLineLength)
+	s := x.newLineSource(reader, newTestMatcher(`^a$`), false, false)
+	defer s.close()
+	for !f.limited() {
+		l, ok := s.next()
+		if !ok {
+			t.Fatal("no more lines")
+		}
+		f.line(l)
+	}
+	f.finish()
+
+	// N.B. the long line ends the run of repeated lines, and counts as kept
+	if got, expected := output.String(), "1:a\nlast line repeated 1 time\n3:long line\n4:a\n"; got != expected {
+		t.Errorf("output = %q, want %q", got, expected)
+	}
+	if !f.content || f.kept != 4 {
+		t.Errorf("content = %v, kept = %d", f.content, f.kept)
+	}
+}
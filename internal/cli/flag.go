@@ -2,6 +2,7 @@ package cli
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 )
 
@@ -9,12 +10,48 @@ const (
 	errorModeDefault   errorMode = `default`
 	errorModeNoContent errorMode = `no-content`
 	errorModeOnContent errorMode = `on-content`
+
+	longLineTruncate longLinePolicy = `truncate`
+	longLinePass     longLinePolicy = `pass`
+	longLineDrop     longLinePolicy = `drop`
+
+	binaryText    binaryPolicy = `text`
+	binarySkip    binaryPolicy = `skip`
+	binaryPass    binaryPolicy = `pass`
+	binarySummary binaryPolicy = `summary`
+
+	maxCountDrain maxCountAction = `drain`
+	maxCountKill  maxCountAction = `kill`
+
+	timestampWall    timestampFormat = `wall`
+	timestampElapsed timestampFormat = `elapsed`
+
+	streamTagsNone  streamTags = `none`
+	streamTagsText  streamTags = `text`
+	streamTagsColor streamTags = `color`
 )
 
 type (
 	stringSliceFlag []string
 
 	errorMode string
+
+	longLinePolicy string
+
+	binaryPolicy string
+
+	maxCountAction string
+
+	// streamTags identifies the stream of each line, see --merge
+	streamTags string
+
+	// timestampFormat is 'wall', 'elapsed', a time layout, or empty, if
+	// disabled. It may be specified without a value, like a bool flag.
+	timestampFormat string
+
+	// byteSize is a number of bytes, optionally with a K, M, or G suffix
+	// (powers of 1024), e.g. '100M'.
+	byteSize int64
 )
 
 func (s *stringSliceFlag) String() string {
@@ -48,3 +85,151 @@ func (x *errorMode) Valid() bool {
 	}
 	return false
 }
+
+func (x *longLinePolicy) String() string {
+	if x.Valid() {
+		return string(*x)
+	}
+	return "invalid (" + string(*x) + ")"
+}
+
+func (x *longLinePolicy) Set(value string) error {
+	if !(*longLinePolicy)(&value).Valid() {
+		return errors.New("invalid long line policy")
+	}
+	*x = longLinePolicy(value)
+	return nil
+}
+
+func (x *longLinePolicy) Valid() bool {
+	switch *x {
+	case longLineTruncate, longLinePass, longLineDrop:
+		return true
+	}
+	return false
+}
+
+func (x *binaryPolicy) String() string {
+	if x.Valid() {
+		return string(*x)
+	}
+	return "invalid (" + string(*x) + ")"
+}
+
+func (x *binaryPolicy) Set(value string) error {
+	if !(*binaryPolicy)(&value).Valid() {
+		return errors.New("invalid binary policy")
+	}
+	*x = binaryPolicy(value)
+	return nil
+}
+
+func (x *binaryPolicy) Valid() bool {
+	switch *x {
+	case binaryText, binarySkip, binaryPass, binarySummary:
+		return true
+	}
+	return false
+}
+
+func (x *maxCountAction) String() string {
+	if x.Valid() {
+		return string(*x)
+	}
+	return "invalid (" + string(*x) + ")"
+}
+
+func (x *maxCountAction) Set(value string) error {
+	if !(*maxCountAction)(&value).Valid() {
+		return errors.New("invalid max count action")
+	}
+	*x = maxCountAction(value)
+	return nil
+}
+
+func (x *maxCountAction) Valid() bool {
+	switch *x {
+	case maxCountDrain, maxCountKill:
+		return true
+	}
+	return false
+}
+
+func (x *streamTags) String() string {
+	if x.Valid() {
+		return string(*x)
+	}
+	return "invalid (" + string(*x) + ")"
+}
+
+func (x *streamTags) Set(value string) error {
+	if !(*streamTags)(&value).Valid() {
+		return errors.New("invalid stream tags")
+	}
+	*x = streamTags(value)
+	return nil
+}
+
+func (x *streamTags) Valid() bool {
+	switch *x {
+	case streamTagsNone, streamTagsText, streamTagsColor:
+		return true
+	}
+	return false
+}
+
+// enabled returns true if lines are tagged, which is not the case for the
+// zero value.
+func (x streamTags) enabled() bool {
+	return x == streamTagsText || x == streamTagsColor
+}
+
+func (x *timestampFormat) String() string {
+	return string(*x)
+}
+
+func (x *timestampFormat) Set(value string) error {
+	switch value {
+	case `true`:
+		*x = timestampWall
+	case `false`:
+		*x = ``
+	default:
+		*x = timestampFormat(value)
+	}
+	return nil
+}
+
+func (x *timestampFormat) IsBoolFlag() bool {
+	return true
+}
+
+var byteSizeSuffixes = [...]struct {
+	suffix string
+	shift  uint
+}{{`G`, 30}, {`M`, 20}, {`K`, 10}}
+
+func (x *byteSize) String() string {
+	for _, s := range byteSizeSuffixes {
+		if *x != 0 && *x%(1<<s.shift) == 0 {
+			return strconv.FormatInt(int64(*x)>>s.shift, 10) + s.suffix
+		}
+	}
+	return strconv.FormatInt(int64(*x), 10)
+}
+
+func (x *byteSize) Set(value string) error {
+	var shift uint
+	for _, s := range byteSizeSuffixes {
+		if v, ok := strings.CutSuffix(strings.ToUpper(value), s.suffix); ok {
+			value, shift = v, s.shift
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)>>shift {
+		return errors.New("invalid size")
+	}
+	*x = byteSize(n << shift)
+	return nil
+}
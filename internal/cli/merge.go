@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mergedLines is the number of lines each stream may have read ahead, when
+// merging stdout and stderr, after which reading that stream stops.
+const mergedLines = 256
+
+// mergedSource reads lines from both stdout and stderr (--merge), each in
+// its own goroutine, yielding them in the order they were read, which is as
+// close as possible to the order they were written. Lines are numbered in
+// that order, and matched as they are yielded.
+//
+// Like parallelSource, a stream stops reading after a long line that is
+// passed through (or dropped), until the caller moves on to the next line,
+// so the caller may use l.reader directly.
+type mergedSource struct {
+	streams [2]mergedStream // stdout, then stderr
+	active  *atomic.Pointer[matcher]
+	lines   chan *scannedLine
+	stop    chan struct{}
+	stopped sync.Once
+	wg      sync.WaitGroup
+	line    *scannedLine // the last line yielded
+	pending *scannedLine // received by wait, to be yielded next
+	number  int
+	stderr  bool // the last line yielded was from stderr
+}
+
+// mergedStream reads the lines of a single stream, see mergedSource.
+type mergedStream struct {
+	lineScanner
+	free   chan *scannedLine
+	resume chan struct{} // continue reading, after an unread line
+}
+
+// newMergedSource returns a lineSource, for --merge.
+func (x *CLI) newMergedSource(stdout, stderr *lineReader, active *atomic.Pointer[matcher], timestamps, rejectRest bool) *mergedSource {
+	s := &mergedSource{
+		active: active,
+		lines:  make(chan *scannedLine, 2*mergedLines),
+		stop:   make(chan struct{}),
+	}
+	for i, reader := range [...]*lineReader{stdout, stderr} {
+		st := &s.streams[i]
+		st.lineScanner = lineScanner{
+			reader:     reader,
+			policy:     x.longLinePolicy,
+			timestamps: timestamps,
+			stderr:     i == 1,
+			rejectRest: rejectRest,
+		}
+		st.free = make(chan *scannedLine, mergedLines)
+		st.resume = make(chan struct{}, 1)
+		for range mergedLines {
+			st.free <- &scannedLine{}
+		}
+	}
+	s.wg.Add(len(s.streams))
+	for i := range s.streams {
+		go s.read(&s.streams[i])
+	}
+	go func() {
+		s.wg.Wait()
+		close(s.lines)
+	}()
+	return s
+}
+
+func (s *mergedSource) read(st *mergedStream) {
+	defer s.wg.Done()
+
+	var line scannedLine
+	for {
+		var l *scannedLine
+		select {
+		case l = <-st.free:
+		case <-s.stop:
+			return
+		}
+
+		if !st.scan(&line) {
+			return
+		}
+		buf := append(l.buf[:0], line.line...)
+		*l = line
+		l.buf, l.line, l.text = buf, buf, buf[:len(line.text)]
+
+		// N.B. never blocks, as there are only as many lines as capacity
+		s.lines <- l
+
+		if l.unread() {
+			select {
+			case <-st.resume:
+			case <-s.stop:
+				return
+			}
+		}
+	}
+}
+
+// stream returns the stream l was read from.
+func (s *mergedSource) stream(l *scannedLine) *mergedStream {
+	if l.info.stderr {
+		return &s.streams[1]
+	}
+	return &s.streams[0]
+}
+
+func (s *mergedSource) next() (*scannedLine, bool) {
+	if l := s.line; l != nil {
+		s.line = nil
+		st := s.stream(l)
+		if l.unread() {
+			st.resume <- struct{}{}
+		}
+		st.free <- l
+	}
+	l, ok := s.pending, true
+	if l != nil {
+		s.pending = nil
+	} else {
+		l, ok = <-s.lines
+	}
+	if !ok {
+		return nil, false
+	}
+	// N.B. a segment only shares the number of the previous line, if it
+	// wasn't interleaved with a line from the other stream
+	if !l.cont || s.number == 0 || l.info.stderr != s.stderr {
+		s.number++
+	}
+	s.stderr = l.info.stderr
+	l.info.number = s.number
+	s.stream(l).match(s.active.Load(), l)
+	s.line = l
+	return l, true
+}
+
+func (s *mergedSource) idle() bool {
+	return s.pending == nil && len(s.lines) == 0
+}
+
+func (s *mergedSource) wait(d time.Duration) bool {
+	if !s.idle() {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case l, ok := <-s.lines:
+		// N.B. once closed, next won't block
+		if ok {
+			s.pending = l
+		}
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// close stops reading, though, unlike the other lineSource implementations,
+// it may block until both stdout and stderr have been written to, or
+// closed.
+func (s *mergedSource) close() {
+	s.stopped.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+// drain keeps reading, as both streams must be read concurrently, writing
+// each line, in order, to w.
+func (s *mergedSource) drain(w io.Writer) {
+	for l, ok := s.next(); ok; l, ok = s.next() {
+		_, _ = w.Write(l.line)
+		if l.unread() {
+			_, _ = l.reader.copyRest(w)
+			_, _ = w.Write(l.reader.terminator())
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_mergedSource(t *testing.T) {
+	const lines = 2000
+
+	input := func(name string) string {
+		var b strings.Builder
+		for i := 1; i <= lines; i++ {
+			if i%100 == 0 {
+				// long lines, passed through
+				fmt.Fprintf(&b, "%s %d %s\n", name, i, strings.Repeat("x", 100))
+			} else {
+				fmt.Fprintf(&b, "%s %d\n", name, i)
+			}
+		}
+		return b.String()
+	}
+
+	var active atomic.Pointer[matcher]
+	active.Store(&matcher{
+		patterns: []*regexp.Regexp{regexp.MustCompile(`0$`), regexp.MustCompile(`5$`)},
+		streams:  []patternStream{streamOut, streamAny},
+	})
+
+	stdout := newLineReader(strings.NewReader(input("out")), 50)
+	stderr := newLineReader(strings.NewReader(input("err")), 50)
+	s := (&CLI{longLinePolicy: longLinePass}).newMergedSource(stdout, stderr, &active, false, false)
+	defer s.close()
+
+	next := map[bool]int{false: 1, true: 1}
+	for number := 1; number <= 2*lines; number++ {
+		l, ok := s.next()
+		if !ok {
+			t.Fatalf("line %d: no more lines", number)
+		}
+		if l.info.number != number {
+			t.Fatalf("line %d: number %d", number, l.info.number)
+		}
+
+		name, reader := "out", stdout
+		if l.info.stderr {
+			name, reader = "err", stderr
+		}
+		if l.reader != reader {
+			t.Fatalf("line %d: wrong reader", number)
+		}
+		i := next[l.info.stderr]
+		next[l.info.stderr]++
+
+		if i%100 == 0 {
+			if !l.long || !strings.HasPrefix(string(l.text), fmt.Sprint(name, " ", i)) {
+				t.Fatalf("line %d: got %q", number, l.text)
+			}
+			var rest strings.Builder
+			if n, _ := l.reader.copyRest(&rest); n != int64(len(fmt.Sprint(name, " ", i))+101-50) || string(l.reader.terminator()) != "\n" {
+				t.Fatalf("line %d: got rest %q", number, rest.String())
+			}
+			continue
+		}
+
+		expected := -1
+		switch {
+		case i%10 == 0 && !l.info.stderr:
+			expected = 0
+		case i%5 == 0 && i%10 != 0:
+			expected = 1
+		}
+		if string(l.line) != fmt.Sprintf("%s %d\n", name, i) || l.index != expected {
+			t.Fatalf("line %d: got %q, index %d, want index %d", number, l.line, l.index, expected)
+		}
+	}
+	if l, ok := s.next(); ok {
+		t.Fatalf("unexpected line %q", l.line)
+	}
+	if next[false] != lines+1 || next[true] != lines+1 {
+		t.Fatalf("got %v lines", next)
+	}
+}
+
+func Test_mergedSource_drain(t *testing.T) {
+	stdout := newLineReader(strings.NewReader("a\nlong line\nb"), 4)
+	stderr := newLineReader(strings.NewReader(""), 4)
+	s := (&CLI{longLinePolicy: longLineDrop}).newMergedSource(stdout, stderr, newTestMatcher(), false, false)
+	defer s.close()
+
+	l, ok := s.next()
+	if !ok || string(l.line) != "a\n" {
+		t.Fatalf("got %q", l.line)
+	}
+	var b strings.Builder
+	s.drain(&b)
+	if got := b.String(); got != "long line\nb" {
+		t.Errorf("got %q", got)
+	}
+	if l, ok := s.next(); ok {
+		t.Fatalf("unexpected line %q", l.line)
+	}
+}
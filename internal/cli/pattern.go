@@ -1,40 +1,333 @@
 package cli
 
 import (
+	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 )
 
+// matcher is an immutable set of compiled patterns. It is swapped out as a
+// whole (never modified) when the pattern files are reloaded.
+type matcher struct {
+	patterns []*regexp.Regexp
+	// limits are the per-pattern limits on kept lines (0 for unlimited),
+	// and names identify each pattern, in messages, both optional
+	limits []int
+	names  []string
+	// streams restrict patterns to stdout or stderr, optional, see --merge
+	streams []patternStream
+	// excludes are the excluding patterns, optional, see excluded, where
+	// excludeOnly is set if every pattern is excluding
+	excludes    []bool
+	excludeOnly bool
+}
+
+// match returns the index of the first pattern matching line, or -1,
+// ignoring excluding patterns.
+func (m *matcher) match(line []byte) int {
+	for i, re := range m.patterns {
+		if m.exclude(i) {
+			continue
+		}
+		if re.Match(line) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchStream is like match, but ignores patterns restricted to the other
+// stream, given whether line was read from stderr.
+func (m *matcher) matchStream(line []byte, stderr bool) int {
+	if m.streams == nil {
+		return m.match(line)
+	}
+	for i, re := range m.patterns {
+		if m.exclude(i) || m.otherStream(i, stderr) {
+			continue
+		}
+		if re.Match(line) {
+			return i
+		}
+	}
+	return -1
+}
+
+// excluded returns true if line matches an excluding pattern (see the
+// exclude directive), in which case it's suppressed, regardless of the other
+// patterns, or -v. If every pattern is excluding (see excludeOnly), any other
+// line is kept.
+func (m *matcher) excluded(line []byte, stderr bool) bool {
+	for i, exclude := range m.excludes {
+		if exclude && !m.otherStream(i, stderr) && m.patterns[i].Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *matcher) exclude(i int) bool {
+	return i < len(m.excludes) && m.excludes[i]
+}
+
+// otherStream returns true if pattern i is restricted to the other stream,
+// given whether the line was read from stderr.
+func (m *matcher) otherStream(i int, stderr bool) bool {
+	if i >= len(m.streams) {
+		return false
+	}
+	stream := m.streams[i]
+	return stream == streamOut && stderr || stream == streamErr && !stderr
+}
+
+// excludeOnly returns true if excludes is set, and every pattern is
+// excluding.
+func excludeOnly(excludes []bool) bool {
+	return excludes != nil && !slices.Contains(excludes, false)
+}
+
+// limit returns the limit on kept lines for pattern i, or 0.
+func (m *matcher) limit(i int) int {
+	if i < len(m.limits) {
+		return m.limits[i]
+	}
+	return 0
+}
+
+// name returns a description of pattern i, for messages.
+func (m *matcher) name(i int) string {
+	if i < len(m.names) {
+		return m.names[i]
+	}
+	return fmt.Sprintf("%q", m.patterns[i].String())
+}
+
 // loadAndCompilePatterns handles init for the patterns and pattern files.
 func (x *CLI) loadAndCompilePatterns() error {
-	var allRawPatterns []string
+	m, err := x.compilePatterns()
+	if err != nil {
+		return err
+	}
+	x.compiledPatterns = m.patterns
+	x.patternLimits = m.limits
+	x.patternNames = m.names
+	x.patternStreams = m.streams
+	x.patternExcludes = m.excludes
+	if x.stderrFiltered() {
+		if x.stderrMatcher, err = x.compileStderrPatterns(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	allRawPatterns = append(allRawPatterns, x.rawPatterns...)
+// newMatcher returns the matcher for the patterns compiled by init.
+func (x *CLI) newMatcher() *matcher {
+	return &matcher{
+		patterns: x.compiledPatterns,
+		limits:   x.patternLimits,
+		names:    x.patternNames,
+		streams:  x.patternStreams,
+
+		excludes:    x.patternExcludes,
+		excludeOnly: excludeOnly(x.patternExcludes),
+	}
+}
+
+// newStderrMatcher returns the matcher for the stderr patterns compiled by
+// init, which matches nothing, if stderr isn't filtered.
+func (x *CLI) newStderrMatcher() *matcher {
+	if x.stderrMatcher == nil {
+		return &matcher{}
+	}
+	return x.stderrMatcher
+}
+
+// compilePatterns loads and compiles all patterns, from flags, presets, and
+// pattern files. It does not modify the receiver, and is safe to call while
+// the command is running (e.g. to reload the pattern files).
+func (x *CLI) compilePatterns() (*matcher, error) {
+	return x.compilePatternSources(x.rawPatterns, x.presets, x.patternFiles)
+}
+
+// compileStderrPatterns is like compilePatterns, for the patterns applied
+// to stderr (--stderr-pattern and --stderr-pattern-file).
+func (x *CLI) compileStderrPatterns() (*matcher, error) {
+	return x.compilePatternSources(x.stderrRawPatterns, nil, x.stderrPatternFiles)
+}
+
+// compilePatternSources implements compilePatterns, for the given patterns,
+// presets, and pattern files (which may be directories or globs).
+func (x *CLI) compilePatternSources(texts, presets, files []string) (*matcher, error) {
+	var allRawPatterns []rawPattern
+
+	for _, text := range texts {
+		allRawPatterns = append(allRawPatterns, rawPattern{text: text})
+	}
 
 	var err error
-	for _, filePath := range x.patternFiles {
-		allRawPatterns, err = readPatternsFromFile(allRawPatterns, filePath)
+	for _, name := range presets {
+		allRawPatterns, err = readPatternsFromPreset(allRawPatterns, name)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	patternFiles, err := expandPatternFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filePath := range patternFiles {
+		allRawPatterns, err = readPatternFile(allRawPatterns, filePath, x.strictPatterns)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	// if no patterns, len(x.compiledPatterns) == 0, handled later
 	if len(allRawPatterns) == 0 {
-		return nil
+		return &matcher{}, nil
+	}
+
+	defaults := x.defaultPatternOptions()
+
+	m := matcher{patterns: make([]*regexp.Regexp, 0, len(allRawPatterns))}
+
+	for i, p := range allRawPatterns {
+		re, err := compilePattern(p, defaults)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, re)
+
+		options := p.options.or(defaults)
+
+		if options.limit > 0 {
+			if m.limits == nil {
+				m.limits = make([]int, len(allRawPatterns))
+				m.names = make([]string, len(allRawPatterns))
+			}
+			m.limits[i] = options.limit
+		}
+
+		if options.stream != streamAny {
+			if m.streams == nil {
+				m.streams = make([]patternStream, len(allRawPatterns))
+				for j := range m.streams {
+					m.streams[j] = streamAny
+				}
+			}
+			m.streams[i] = options.stream
+		}
+
+		if options.exclude == excludeTrue {
+			if m.excludes == nil {
+				m.excludes = make([]bool, len(allRawPatterns))
+			}
+			m.excludes[i] = true
+		}
+	}
+	m.excludeOnly = excludeOnly(m.excludes)
+
+	if m.limits != nil {
+		for i, p := range allRawPatterns {
+			m.names[i] = patternName(p)
+		}
 	}
 
-	x.compiledPatterns = make([]*regexp.Regexp, 0, len(allRawPatterns))
+	return &m, nil
+}
 
-	for _, pStr := range allRawPatterns {
-		x.compiledPatterns = append(x.compiledPatterns, compileSinglePattern(pStr))
+// patternName describes a pattern, for messages, e.g. `"text" (file:1)`.
+func patternName(p rawPattern) string {
+	if p.source != `` {
+		return fmt.Sprintf("%q (%s)", p.text, p.source)
 	}
+	return fmt.Sprintf("%q", p.text)
+}
 
-	return nil
+// defaultPatternOptions returns the options for patterns that don't specify
+// them, e.g. via a directive header.
+func (x *CLI) defaultPatternOptions() patternOptions {
+	syntax := syntaxWildcard
+	if x.pathGlob {
+		syntax = syntaxPathGlob
+	}
+	limit := x.perPatternLimit
+	if limit == 0 {
+		limit = limitNone
+	}
+	return patternOptions{
+		syntax:   syntax,
+		caseMode: caseSensitive,
+		anchor:   anchorLine,
+		limit:    limit,
+		stream:   streamAny,
+		exclude:  excludeFalse,
+	}
 }
 
-// compileSinglePattern complies a regex from a single pattern string.
+// compilePattern compiles a regex from a pattern, per its options, using
+// defaults for any that are unset.
+func compilePattern(p rawPattern, defaults patternOptions) (*regexp.Regexp, error) {
+	options := p.options.or(defaults)
+
+	var regexStr string
+	switch options.syntax {
+	case syntaxWildcard:
+		regexStr = wildcardToRegex(p.text)
+	case syntaxPathGlob:
+		regexStr = pathGlobToRegex(p.text)
+	case syntaxRegex:
+		if _, err := regexp.Compile(p.text); err != nil {
+			if p.source != `` {
+				return nil, fmt.Errorf("%s: invalid regex %q: %w", p.source, p.text, err)
+			}
+			return nil, fmt.Errorf("invalid regex %q: %w", p.text, err)
+		}
+		regexStr = `(?:` + p.text + `)`
+	default:
+		panic(fmt.Sprintf("unexpected pattern syntax %q", options.syntax))
+	}
+
+	if options.anchor == anchorLine {
+		regexStr = anchorToLine(regexStr)
+	}
+
+	if options.caseMode == caseInsensitive {
+		regexStr = `(?i)` + regexStr
+	}
+
+	return regexp.MustCompile(regexStr), nil
+}
+
+// compileSinglePattern complies a regex from a single pattern string, using
+// the default (wildcard) syntax.
 func compileSinglePattern(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(anchorToLine(wildcardToRegex(pattern)))
+}
+
+// anyText is the regex for a wildcard ('*') matching anything.
+const anyText = "(?s:.*)"
+
+// anchorToLine anchors an (unanchored) regex to the entire line, omitting
+// any anchor made redundant by a leading or trailing wildcard, which is
+// equivalent, but much faster to match, e.g. '*error*' matches like 'error'.
+func anchorToLine(regexStr string) string {
+	start, end := `^`, `$`
+	if s, ok := strings.CutPrefix(regexStr, anyText); ok {
+		regexStr, start = s, ``
+	}
+	if s, ok := strings.CutSuffix(regexStr, anyText); ok {
+		regexStr, end = s, ``
+	}
+	return start + regexStr + end
+}
+
+// wildcardToRegex converts a wildcard pattern to an (unanchored) regex.
+func wildcardToRegex(pattern string) string {
 	var (
 		i        int
 		char     rune
@@ -42,8 +335,6 @@ func compileSinglePattern(pattern string) *regexp.Regexp {
 		regexStr strings.Builder
 	)
 
-	regexStr.WriteString("^")
-
 	for ; i < len(runes); i++ {
 		char = runes[i]
 		if char == '*' {
@@ -54,8 +345,8 @@ func compileSinglePattern(pattern string) *regexp.Regexp {
 				// consume second asterisk
 				i++
 			} else {
-				// wildcard match
-				regexStr.WriteString(".*")
+				// wildcard match (N.B. records may contain newlines, see -z)
+				regexStr.WriteString(anyText)
 			}
 		} else {
 			// match literal character
@@ -64,7 +355,54 @@ func compileSinglePattern(pattern string) *regexp.Regexp {
 		}
 	}
 
-	regexStr.WriteString("$")
+	return regexStr.String()
+}
+
+// pathGlobToRegex converts a path glob pattern to an (unanchored) regex.
+// Unlike wildcard patterns, '*' does not match '/', '**' as an entire path
+// segment matches any number of directories, and '\' escapes the following
+// character (e.g. '\*' for a literal asterisk).
+func pathGlobToRegex(pattern string) string {
+	var (
+		runes    = []rune(pattern)
+		regexStr strings.Builder
+	)
+
+	for i := 0; i < len(runes); i++ {
+		switch char := runes[i]; char {
+		case '\\':
+			// escape, or a literal backslash if at the end
+			if i+1 < len(runes) {
+				i++
+				char = runes[i]
+			}
+			regexStr.WriteString(regexp.QuoteMeta(string(char)))
+
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' && (i == 0 || runes[i-1] == '/') {
+				if i+2 == len(runes) {
+					// trailing "**", matches everything
+					regexStr.WriteString(anyText)
+					i++
+					continue
+				}
+				if runes[i+2] == '/' {
+					// "**/", matches zero or more directories
+					regexStr.WriteString(`(?s:.*/)?`)
+					i += 2
+					continue
+				}
+			}
+			// any other run of asterisks is a single wildcard, within a segment
+			for i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+			}
+			regexStr.WriteString(`[^/]*`)
+
+		default:
+			regexStr.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
 
-	return regexp.MustCompile(regexStr.String())
+	return regexStr.String()
 }
@@ -246,3 +246,212 @@ func Test_compileSinglePattern_edgeCases(t *testing.T) {
 		})
 	}
 }
+
+func Test_anchorToLine(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"abc":    `^abc$`,
+		"*abc":   `abc$`,
+		"abc*":   `^abc`,
+		"*abc*":  `abc`,
+		"*":      `$`,
+		"**":     `^\*$`,
+		"**abc*": `^\*abc`,
+		"a*c":    `^a(?s:.*)c$`,
+	} {
+		if got := anchorToLine(wildcardToRegex(pattern)); got != expected {
+			t.Errorf("anchorToLine(wildcardToRegex(%q)) = %q, want %q", pattern, got, expected)
+		}
+	}
+}
+
+func Test_pathGlobToRegex(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "*.go",
+			match:   []string{"main.go", ".go"},
+			noMatch: []string{"cmd/main.go", "main.go.bak"},
+		},
+		{
+			pattern: "src/*/main.go",
+			match:   []string{"src/foo/main.go", "src//main.go"},
+			noMatch: []string{"src/main.go", "src/foo/bar/main.go"},
+		},
+		{
+			pattern: "**/*.go",
+			match:   []string{"main.go", "cmd/main.go", "a/b/c/main.go"},
+			noMatch: []string{"main.go/x", "a/b/main.txt"},
+		},
+		{
+			pattern: "src/**/test/*_test.go",
+			match:   []string{"src/test/a_test.go", "src/a/test/a_test.go", "src/a/b/test/a_test.go"},
+			noMatch: []string{"src/test/a/a_test.go", "srctest/a_test.go", "other/src/test/a_test.go"},
+		},
+		{
+			pattern: "vendor/**",
+			match:   []string{"vendor/", "vendor/a", "vendor/a/b/c"},
+			noMatch: []string{"vendor", "vendors/a", "a/vendor/b"},
+		},
+		{
+			pattern: "**",
+			match:   []string{"", "a", "a/b/c"},
+		},
+		{
+			pattern: "a**b",
+			match:   []string{"ab", "axxb"},
+			noMatch: []string{"a/b"},
+		},
+		{
+			pattern: `literal\*star`,
+			match:   []string{"literal*star"},
+			noMatch: []string{"literalstar", "literalxstar"},
+		},
+		{
+			pattern: `a\\b\`,
+			match:   []string{`a\b\`},
+		},
+		{
+			pattern: "file.(1).txt",
+			match:   []string{"file.(1).txt"},
+			noMatch: []string{"filex(1)xtxt"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			re, err := compilePattern(rawPattern{text: tc.pattern}, patternOptions{syntax: syntaxPathGlob, caseMode: caseSensitive, anchor: anchorLine})
+			if err != nil {
+				t.Fatalf("compilePattern() error = %v", err)
+			}
+
+			for _, s := range tc.match {
+				if !re.MatchString(s) {
+					t.Errorf("pattern %q (regex %q) should match %q but didn't", tc.pattern, re, s)
+				}
+			}
+
+			for _, s := range tc.noMatch {
+				if re.MatchString(s) {
+					t.Errorf("pattern %q (regex %q) shouldn't match %q but did", tc.pattern, re, s)
+				}
+			}
+		})
+	}
+}
+
+func TestCLI_loadAndCompilePatterns_pathGlob(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	wildcardFile := filepath.Join(tmpDir, "wildcard.txt")
+	if err := os.WriteFile(wildcardFile, []byte("#!scof syntax=wildcard\nsrc/*\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cli := &CLI{
+		rawPatterns:  []string{"cmd/*"},
+		patternFiles: []string{wildcardFile},
+		pathGlob:     true,
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+	m := &matcher{patterns: cli.compiledPatterns}
+
+	if m.match([]byte("cmd/main.go")) != 0 || m.match([]byte("cmd/foo/main.go")) != -1 {
+		t.Error("expected -p patterns to be path globs")
+	}
+	if m.match([]byte("src/foo/main.go")) != 1 {
+		t.Error("expected the directive header to override --path-glob")
+	}
+}
+
+func TestCLI_loadAndCompilePatterns_exclude(t *testing.T) {
+	patternFile := filepath.Join(t.TempDir(), "exclude.patterns")
+	if err := os.WriteFile(patternFile, []byte("#!scof exclude=true\nnoise *\nerror: noise #!scof exclude=false\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cli := &CLI{
+		rawPatterns:  []string{"error: *"},
+		patternFiles: []string{patternFile},
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+	m := cli.newMatcher()
+	if m.excludeOnly {
+		t.Error("expected not every pattern to be excluding")
+	}
+
+	for _, tc := range [...]struct {
+		line     string
+		index    int
+		excluded bool
+	}{
+		{"error: a", 0, false},
+		{"error: noise", 0, false},
+		{"noise a", -1, true},
+		{"other", -1, false},
+	} {
+		if got := m.match([]byte(tc.line)); got != tc.index {
+			t.Errorf("match(%q) = %d, want %d", tc.line, got, tc.index)
+		}
+		if got := m.excluded([]byte(tc.line), false); got != tc.excluded {
+			t.Errorf("excluded(%q) = %v, want %v", tc.line, got, tc.excluded)
+		}
+	}
+
+	excludeOnly := &CLI{patternFiles: []string{patternFile}}
+	if err := excludeOnly.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+	if m := excludeOnly.newMatcher(); m.excludeOnly {
+		t.Error("expected the inline directive to override the header")
+	}
+}
+
+func TestCLI_loadAndCompilePatterns_stream(t *testing.T) {
+	patternFile := filepath.Join(t.TempDir(), "stream.patterns")
+	if err := os.WriteFile(patternFile, []byte("#!scof stream=err\nwarning: *\nerror: * #!scof stream=any\nok * #!scof stream=out\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cli := &CLI{
+		rawPatterns:  []string{"note: *"},
+		patternFiles: []string{patternFile},
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+	m := cli.newMatcher()
+
+	for _, tc := range [...]struct {
+		line     string
+		stderr   bool
+		expected int
+	}{
+		{"note: a", false, 0},
+		{"note: a", true, 0},
+		{"warning: a", false, -1},
+		{"warning: a", true, 1},
+		{"error: a", false, 2},
+		{"error: a", true, 2},
+		{"ok a", false, 3},
+		{"ok a", true, -1},
+	} {
+		if got := m.matchStream([]byte(tc.line), tc.stderr); got != tc.expected {
+			t.Errorf("matchStream(%q, %v) = %d, want %d", tc.line, tc.stderr, got, tc.expected)
+		}
+	}
+
+	unrestricted := &CLI{rawPatterns: []string{"note: *"}}
+	if err := unrestricted.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+	if unrestricted.patternStreams != nil {
+		t.Errorf("Expected no pattern streams, got %v", unrestricted.patternStreams)
+	}
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"time"
+)
+
+// wallTimestampLayout is the layout of --timestamp=wall.
+const wallTimestampLayout = `2006-01-02T15:04:05.000Z07:00`
+
+// stderrColor and resetColor are the ANSI escape sequences that color lines
+// from stderr, with --stream-tags=color.
+const (
+	stderrColor = "\x1b[31m"
+	resetColor  = "\x1b[0m"
+)
+
+// lineInfo is metadata about a line, captured as it was read.
+type lineInfo struct {
+	number int       // the original line number, starting at 1
+	read   time.Time // zero unless --timestamp is set
+	stderr bool      // read from stderr, only with --merge
+}
+
+// linePrefixer writes lines prefixed with their line number (-n), and/or
+// timestamp (--timestamp), and/or stream (--stream-tags), e.g.
+// "[2006-01-02T15:04:05.000Z] [err] 12:text".
+type linePrefixer struct {
+	numbers   bool
+	timestamp timestampFormat
+	tags      streamTags
+	start     time.Time
+	buf       []byte
+}
+
+// newLinePrefixer returns nil if lines aren't prefixed.
+func (x *CLI) newLinePrefixer(start time.Time) *linePrefixer {
+	if !x.lineNumbers && x.timestamp == `` && !x.streamTags.enabled() {
+		return nil
+	}
+	p := linePrefixer{
+		numbers:   x.lineNumbers,
+		timestamp: x.timestamp,
+		start:     start,
+	}
+	if x.streamTags.enabled() {
+		p.tags = x.streamTags
+	}
+	return &p
+}
+
+// appendPrefix appends the prefix for a line to b, where the line number
+// is followed by sep, which is ':' for kept lines, or '-' for context lines,
+// like grep.
+func (p *linePrefixer) appendPrefix(b []byte, info lineInfo, sep byte) []byte {
+	if p.colored(info) {
+		b = append(b, stderrColor...)
+	}
+	if p.timestamp != `` {
+		b = append(b, '[')
+		switch p.timestamp {
+		case timestampWall:
+			b = info.read.AppendFormat(b, wallTimestampLayout)
+		case timestampElapsed:
+			elapsed := strconv.FormatFloat(info.read.Sub(p.start).Seconds(), 'f', 3, 64)
+			for i := len(elapsed); i < 10; i++ {
+				b = append(b, ' ')
+			}
+			b = append(b, elapsed...)
+		default:
+			b = info.read.AppendFormat(b, string(p.timestamp))
+		}
+		b = append(b, ']', ' ')
+	}
+	if p.tags == streamTagsText {
+		if info.stderr {
+			b = append(b, "[err] "...)
+		} else {
+			b = append(b, "[out] "...)
+		}
+	}
+	if p.numbers {
+		b = strconv.AppendInt(b, int64(info.number), 10)
+		b = append(b, sep)
+	}
+	return b
+}
+
+// appendSuffix appends what must follow a line to b, preceding the
+// terminator, i.e. the reset for a colored line.
+func (p *linePrefixer) appendSuffix(b []byte, info lineInfo) []byte {
+	if p.colored(info) {
+		b = append(b, resetColor...)
+	}
+	return b
+}
+
+// colored returns true if the line is colored, see --stream-tags.
+func (p *linePrefixer) colored(info lineInfo) bool {
+	return p.tags == streamTagsColor && info.stderr
+}
+
+// format returns line, prefixed as per appendPrefix, and suffixed as per
+// appendSuffix, which is valid until the next call.
+func (p *linePrefixer) format(line []byte, info lineInfo, sep byte) []byte {
+	text := line
+	if p.colored(info) {
+		text = bytes.TrimRight(line, "\r\n")
+	}
+	p.buf = append(p.appendPrefix(p.buf[:0], info, sep), text...)
+	p.buf = append(p.appendSuffix(p.buf, info), line[len(text):]...)
+	return p.buf
+}
+
+// write writes line to w, in a single call, formatted as per format.
+func (p *linePrefixer) write(w io.Writer, line []byte, info lineInfo, sep byte) {
+	_, _ = w.Write(p.format(line, info, sep))
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_linePrefixer(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	read := start.Add(1234567 * time.Microsecond)
+
+	for _, tc := range [...]struct {
+		name     string
+		cli      CLI
+		sep      byte
+		stderr   bool
+		expected string
+	}{
+		{"numbers", CLI{lineNumbers: true}, ':', false, "12:text\n"},
+		{"numbers context", CLI{lineNumbers: true}, '-', false, "12-text\n"},
+		{"wall", CLI{timestamp: timestampWall}, ':', false, "[2026-01-02T03:04:06.234Z] text\n"},
+		{"elapsed", CLI{timestamp: timestampElapsed, lineNumbers: true}, ':', false, "[     1.235] 12:text\n"},
+		{"layout", CLI{timestamp: "15:04:05", lineNumbers: true}, '-', false, "[03:04:06] 12-text\n"},
+		{"tags out", CLI{streamTags: streamTagsText}, ':', false, "[out] text\n"},
+		{"tags err", CLI{streamTags: streamTagsText, lineNumbers: true}, '-', true, "[err] 12-text\n"},
+		{"tags none", CLI{streamTags: streamTagsNone, lineNumbers: true}, ':', true, "12:text\n"},
+		{"color out", CLI{streamTags: streamTagsColor}, ':', false, "text\n"},
+		{"color err", CLI{streamTags: streamTagsColor, timestamp: "15:04:05"}, ':', true, "\x1b[31m[03:04:06] text\x1b[0m\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := tc.cli.newLinePrefixer(start)
+			var b bytes.Buffer
+			p.write(&b, []byte("text\n"), lineInfo{number: 12, read: read, stderr: tc.stderr}, tc.sep)
+			if b.String() != tc.expected {
+				t.Errorf("got %q, want %q", b.String(), tc.expected)
+			}
+		})
+	}
+
+	if p := (&CLI{}).newLinePrefixer(start); p != nil {
+		t.Error("expected nil prefixer")
+	}
+	if p := (&CLI{streamTags: streamTagsNone}).newLinePrefixer(start); p != nil {
+		t.Error("expected nil prefixer, for no stream tags")
+	}
+}
+
+func Test_timestampFormat_Set(t *testing.T) {
+	for value, expected := range map[string]timestampFormat{
+		"true":     timestampWall,
+		"false":    "",
+		"elapsed":  timestampElapsed,
+		"15:04:05": "15:04:05",
+	} {
+		var f timestampFormat
+		if err := f.Set(value); err != nil {
+			t.Fatal(err)
+		}
+		if f != expected {
+			t.Errorf("Set(%q) = %q, want %q", value, f, expected)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// presetFS contains the built-in presets, which are ordinary pattern files,
+// named after the preset. The first line of each is a comment describing it.
+//
+//go:embed presets/*.patterns
+var presetFS embed.FS
+
+// presetNames returns the names of all built-in presets, in lexical order.
+func presetNames() []string {
+	entries, err := presetFS.ReadDir(`presets`)
+	if err != nil {
+		panic(err) // embedded, so should be impossible
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), patternFileExt))
+	}
+	return names
+}
+
+// readPatternsFromPreset is readPatternFile, for a built-in preset.
+func readPatternsFromPreset(allRawPatterns []rawPattern, name string) ([]rawPattern, error) {
+	file, err := presetFS.Open(path.Join(`presets`, name+patternFileExt))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unknown preset %q (see --list-presets)", name)
+		}
+		return nil, fmt.Errorf("failed to open preset %q: %w", name, err)
+	}
+	defer file.Close()
+	// N.B. presets are always strict, they have no reason not to be
+	return readPatterns(allRawPatterns, file, `preset:`+name, true)
+}
+
+// presetDescription returns the first line comment of the named preset.
+func presetDescription(name string) string {
+	file, err := presetFS.Open(path.Join(`presets`, name+patternFileExt))
+	if err != nil {
+		return ``
+	}
+	defer file.Close()
+	// N.B. the description follows any directive header
+	reader := bufio.NewReader(file)
+	line, _ := reader.ReadString('\n')
+	if isDirectiveHeader(strings.TrimSpace(line)) {
+		line, _ = reader.ReadString('\n')
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, `#`))
+}
+
+// printPresets writes the name and description of each built-in preset.
+func printPresets(w io.Writer) {
+	names := presetNames()
+	var width int
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "%-*s  %s\n", width, name, presetDescription(name))
+	}
+}
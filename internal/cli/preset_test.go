@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_presets_allLoad(t *testing.T) {
+	names := presetNames()
+	if len(names) == 0 {
+		t.Fatal("expected at least one preset")
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			patterns, err := readPatternsFromPreset(nil, name)
+			if err != nil {
+				t.Fatalf("readPatternsFromPreset(%q) error = %v", name, err)
+			}
+			if len(patterns) == 0 {
+				t.Errorf("preset %q has no patterns", name)
+			}
+			if presetDescription(name) == "" {
+				t.Errorf("preset %q has no description", name)
+			}
+		})
+	}
+}
+
+func Test_presets_matching(t *testing.T) {
+	for _, tc := range [...]struct {
+		preset  string
+		exclude bool // every pattern is excluding
+		match   []string
+		noMatch []string
+	}{
+		{
+			preset:  "go-test-failures",
+			match:   []string{"--- FAIL: TestFoo (0.00s)", "    --- FAIL: TestFoo/bar (0.00s)", "FAIL", "FAIL\tgithub.com/foo/bar\t0.012s", "    foo_test.go:12: unexpected", "panic: runtime error: index out of range [recovered]", "exit status 1"},
+			noMatch: []string{"=== RUN   TestFoo", "--- PASS: TestFoo (0.00s)", "PASS", "ok  \tgithub.com/foo/bar\t0.012s"},
+		},
+		{
+			preset:  "go-build-errors",
+			match:   []string{"# github.com/foo/bar", "./main.go:12:2: undefined: x", "go: downloading example.com/x v1.0.0"},
+			noMatch: []string{"ok", "main.go"},
+		},
+		{
+			preset:  "npm-warnings",
+			match:   []string{"npm WARN deprecated foo@1.0.0: use bar", "npm warn deprecated foo@1.0.0", "npm ERR! code E404", "npm error code E404"},
+			noMatch: []string{"added 12 packages in 1s"},
+		},
+		{
+			preset:  "make-noise",
+			exclude: true,
+			match:   []string{"make[1]: Entering directory '/src/foo'", "make[1]: Leaving directory '/src/foo'", "make: Nothing to be done for 'all'.", "make: 'foo' is up to date.", "make: `foo' is up to date."},
+			noMatch: []string{"cc -o foo foo.c", "make: *** [Makefile:2: all] Error 1"},
+		},
+	} {
+		t.Run(tc.preset, func(t *testing.T) {
+			cli := &CLI{presets: []string{tc.preset}}
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatalf("loadAndCompilePatterns() error = %v", err)
+			}
+			m := cli.newMatcher()
+			if m.excludeOnly != tc.exclude {
+				t.Errorf("preset %q excludeOnly = %v, want %v", tc.preset, m.excludeOnly, tc.exclude)
+			}
+			matches := func(s string) bool {
+				return m.match([]byte(s)) != -1 || m.excluded([]byte(s), false)
+			}
+			for _, s := range tc.match {
+				if !matches(s) {
+					t.Errorf("preset %q should match %q but didn't", tc.preset, s)
+				}
+			}
+			for _, s := range tc.noMatch {
+				if matches(s) {
+					t.Errorf("preset %q shouldn't match %q but did", tc.preset, s)
+				}
+			}
+		})
+	}
+}
+
+func TestCLI_loadAndCompilePatterns_presetCombined(t *testing.T) {
+	cli := &CLI{
+		rawPatterns: []string{"raw*"},
+		presets:     []string{"npm-warnings"},
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+	m := &matcher{patterns: cli.compiledPatterns}
+	if m.match([]byte("raw pattern")) != 0 {
+		t.Error("expected the raw pattern to be first")
+	}
+	if m.match([]byte("npm WARN foo")) <= 0 {
+		t.Error("expected the preset patterns to follow the raw patterns")
+	}
+}
+
+func TestCLI_loadAndCompilePatterns_unknownPreset(t *testing.T) {
+	cli := &CLI{presets: []string{"does-not-exist"}}
+	err := cli.loadAndCompilePatterns()
+	if err == nil || !strings.Contains(err.Error(), `unknown preset "does-not-exist"`) {
+		t.Fatalf("expected an unknown preset error, got %v", err)
+	}
+}
+
+func TestCLI_Main_listPresets(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	cli := &CLI{
+		Input:  strings.NewReader(""),
+		Output: &stdout,
+		ErrOut: &stderr,
+	}
+	if code := cli.Main([]string{"--list-presets"}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr.String())
+	}
+	for _, name := range presetNames() {
+		if !strings.Contains(stdout.String(), name+" ") {
+			t.Errorf("expected %q to be listed, got %q", name, stdout.String())
+		}
+	}
+}
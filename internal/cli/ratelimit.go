@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitReportInterval is how often lines dropped due to --rate-limit
+	// are reported.
+	rateLimitReportInterval = 10 * time.Second
+
+	// rateLimitTailLines is the number of most recently dropped lines which
+	// are written at exit, so the final lines are never hidden.
+	rateLimitTailLines = 10
+)
+
+// rateLimit is the value of --rate-limit, LINES/DURATION, e.g. '100/1s',
+// where the unit alone (e.g. '100/s') means one of that unit.
+type rateLimit struct {
+	lines int
+	per   time.Duration
+}
+
+func (x *rateLimit) String() string {
+	if x.lines == 0 {
+		return ``
+	}
+	return strconv.Itoa(x.lines) + `/` + x.per.String()
+}
+
+func (x *rateLimit) Set(value string) error {
+	if value == `` || value == `0` {
+		*x = rateLimit{}
+		return nil
+	}
+	lines, per, ok := strings.Cut(value, `/`)
+	if !ok {
+		return errors.New("invalid rate limit, expected LINES/DURATION")
+	}
+	n, err := strconv.Atoi(lines)
+	if err != nil || n <= 0 {
+		return errors.New("invalid rate limit, LINES must be a positive integer")
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil {
+		d, err = time.ParseDuration(`1` + per)
+	}
+	if err != nil || d <= 0 {
+		return errors.New("invalid rate limit, DURATION must be positive, e.g. '1s'")
+	}
+	*x = rateLimit{lines: n, per: d}
+	return nil
+}
+
+// rateLimiter limits the rate of writes (lines) to w (--rate-limit), using
+// a token bucket, which starts full, allowing bursts of up to the limit.
+// Dropped lines are counted, and periodically reported to errOut, while the
+// most recently dropped lines are retained, and written by flush. Lines
+// written via writeLine are written to rejected, if dropped, though only once
+// they are no longer retained, as they may yet be written.
+//
+// Each call to Write is treated as a line. It is safe for concurrent use.
+type rateLimiter struct {
+	mu             sync.Mutex
+	w              io.Writer
+	errOut         io.Writer
+	capacity       float64
+	rate           float64 // tokens per second
+	tokens         float64
+	last           time.Time
+	now            func() time.Time
+	reportInterval time.Duration
+	timer          *time.Timer
+	pending        int // dropped since the last report
+	total          int
+	tail           lineRing // of dropped lines, since the last written line
+	tailLines      lineRing // of the tail, as read, rejected once evicted
+	done           bool     // flushed, no longer limiting
+}
+
+// newRateLimiter returns nil if the rate isn't limited. The rejected writer
+// may be nil.
+func (x *CLI) newRateLimiter(w, errOut, rejected io.Writer) *rateLimiter {
+	if x.rateLimit.lines <= 0 {
+		return nil
+	}
+	r := &rateLimiter{
+		w:              w,
+		errOut:         errOut,
+		capacity:       float64(x.rateLimit.lines),
+		rate:           float64(x.rateLimit.lines) / x.rateLimit.per.Seconds(),
+		tokens:         float64(x.rateLimit.lines),
+		now:            time.Now,
+		reportInterval: rateLimitReportInterval,
+		tail:           newLineRing(rateLimitTailLines),
+		tailLines:      newLineRing(rateLimitTailLines),
+	}
+	if rejected != nil {
+		r.tailLines.evicted = func(line []byte, _ lineInfo) {
+			_, _ = rejected.Write(line)
+		}
+	}
+	r.last = r.now()
+	return r
+}
+
+// Write writes p, if the rate allows it, otherwise p is dropped, though a
+// copy may be retained, to be written by flush.
+func (r *rateLimiter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writeLocked(p, nil)
+}
+
+// writeLine writes p, like Write, where p is a line, as formatted (e.g.
+// prefixed), and line is as read, which is written to rejected, if dropped,
+// and not written by flush.
+func (r *rateLimiter) writeLine(p, line []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.writeLocked(p, line)
+}
+
+func (r *rateLimiter) writeLocked(p, line []byte) (int, error) {
+	if r.allowLocked() {
+		r.resetTailLocked()
+		return r.w.Write(p)
+	}
+	r.tail.push(p, lineInfo{})
+	r.tailLines.push(line, lineInfo{})
+	return len(p), nil
+}
+
+// allow consumes a token, returning false, and counting a dropped line, if
+// there were none, e.g. for lines too long to be written via Write.
+func (r *rateLimiter) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.allowLocked() {
+		r.resetTailLocked()
+		return true
+	}
+	// N.B. the retained lines would no longer be the final lines
+	r.resetTailLocked()
+	return false
+}
+
+// resetTailLocked discards the retained lines, rejecting them, as they will
+// no longer be written.
+func (r *rateLimiter) resetTailLocked() {
+	r.tail.reset()
+	r.tailLines.reset()
+}
+
+func (r *rateLimiter) allowLocked() bool {
+	if r.done {
+		return true
+	}
+	now := r.now()
+	if elapsed := now.Sub(r.last); elapsed > 0 {
+		r.tokens = min(r.capacity, r.tokens+elapsed.Seconds()*r.rate)
+	}
+	r.last = now
+	if r.tokens >= 1 {
+		r.tokens--
+		return true
+	}
+	r.pending++
+	r.total++
+	if r.timer == nil && r.reportInterval > 0 {
+		r.timer = time.AfterFunc(r.reportInterval, r.report)
+	}
+	return false
+}
+
+func (r *rateLimiter) report() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timer = nil
+	if r.pending != 0 && !r.done {
+		r.warnLocked("Warning: --rate-limit dropped %d line%s\n", r.pending)
+		r.pending = 0
+	}
+}
+
+func (r *rateLimiter) warnLocked(format string, n int) {
+	suffix := `s`
+	if n == 1 {
+		suffix = ``
+	}
+	_, _ = fmt.Fprintf(r.errOut, format, n, suffix)
+}
+
+// flush writes the retained lines, i.e. the most recently dropped lines,
+// if nothing was written since, then reports the total dropped, and stops
+// limiting, so anything written afterwards (e.g. summaries) is not dropped.
+func (r *rateLimiter) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.total -= r.tail.n
+	r.tail.drain(func(line []byte, _ lineInfo) {
+		_, _ = r.w.Write(line)
+	})
+	r.tailLines.drain(func([]byte, lineInfo) {})
+	if r.total != 0 {
+		r.warnLocked("Warning: --rate-limit dropped %d line%s in total\n", r.total)
+	}
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_rateLimit_Set(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected rateLimit
+		err      bool
+	}{
+		{value: "100/1s", expected: rateLimit{lines: 100, per: time.Second}},
+		{value: "5/m", expected: rateLimit{lines: 5, per: time.Minute}},
+		{value: "1/250ms", expected: rateLimit{lines: 1, per: 250 * time.Millisecond}},
+		{value: "0"},
+		{value: ""},
+		{value: "100", err: true},
+		{value: "0/1s", err: true},
+		{value: "-1/1s", err: true},
+		{value: "x/1s", err: true},
+		{value: "1/0s", err: true},
+		{value: "1/-1s", err: true},
+		{value: "1/fortnight", err: true},
+	} {
+		var got rateLimit
+		err := got.Set(tc.value)
+		if (err != nil) != tc.err {
+			t.Errorf("Set(%q) error = %v", tc.value, err)
+		} else if got != tc.expected {
+			t.Errorf("Set(%q) = %+v, want %+v", tc.value, got, tc.expected)
+		}
+	}
+	if v := (&rateLimit{lines: 5, per: time.Minute}).String(); v != "5/1m0s" {
+		t.Errorf("String() = %q", v)
+	}
+}
+
+func Test_rateLimiter(t *testing.T) {
+	var (
+		out, errOut bytes.Buffer
+		now         = time.Unix(0, 0)
+	)
+	r := (&CLI{rateLimit: rateLimit{lines: 2, per: time.Second}}).newRateLimiter(&out, &errOut, nil)
+	r.now = func() time.Time { return now }
+	r.last = now
+	r.reportInterval = 0
+	write := func(lines ...string) {
+		for _, line := range lines {
+			_, _ = r.Write([]byte(line + "\n"))
+		}
+	}
+
+	// burst, then one line per 500ms
+	write("a", "b", "c")
+	now = now.Add(500 * time.Millisecond)
+	write("d", "e")
+	now = now.Add(time.Second)
+	write("f", "g", "h")
+	if r.allow() {
+		t.Error("expected no tokens")
+	}
+	now = now.Add(10 * time.Second)
+	write("i", "j")
+	for i := range 15 {
+		write(strings.Repeat("k", i+1))
+	}
+	r.flush()
+	write("l", "m")
+
+	expected := "a\nb\nd\nf\ng\ni\nj\n" + func() string {
+		var b strings.Builder
+		for i := 6; i <= 15; i++ {
+			b.WriteString(strings.Repeat("k", i) + "\n")
+		}
+		return b.String()
+	}() + "l\nm\n"
+	if out.String() != expected {
+		t.Errorf("out = %q, want %q", out.String(), expected)
+	}
+	if expected := "Warning: --rate-limit dropped 9 lines in total\n"; errOut.String() != expected {
+		t.Errorf("errOut = %q, want %q", errOut.String(), expected)
+	}
+}
+
+func Test_rateLimiter_report(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := (&CLI{rateLimit: rateLimit{lines: 1, per: time.Hour}}).newRateLimiter(&out, lockWriter(&errOut), nil)
+	r.reportInterval = 10 * time.Millisecond
+	_, _ = r.Write([]byte("a\n"))
+	_, _ = r.Write([]byte("b\n"))
+	time.Sleep(100 * time.Millisecond)
+	r.mu.Lock()
+	got := errOut.String()
+	r.mu.Unlock()
+	if expected := "Warning: --rate-limit dropped 1 line\n"; got != expected {
+		t.Errorf("errOut = %q, want %q", got, expected)
+	}
+	r.flush()
+	if expected := "a\nb\n"; out.String() != expected {
+		t.Errorf("out = %q, want %q", out.String(), expected)
+	}
+	if expected := "Warning: --rate-limit dropped 1 line\n"; errOut.String() != expected {
+		t.Errorf("errOut = %q, want %q", errOut.String(), expected)
+	}
+}
+
+func Test_rateLimiter_rejected(t *testing.T) {
+	var out, errOut, rejected bytes.Buffer
+	r := (&CLI{rateLimit: rateLimit{lines: 1, per: time.Hour}}).newRateLimiter(&out, &errOut, &rejected)
+	r.reportInterval = 0
+	write := func(lines ...string) {
+		for _, line := range lines {
+			r.writeLine([]byte(">"+line+"\n"), []byte(line+"\n"))
+		}
+	}
+
+	// N.B. dropped lines are only rejected once they are no longer retained
+	write("a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l")
+	if expected := "b\n"; rejected.String() != expected {
+		t.Errorf("rejected = %q, want %q", rejected.String(), expected)
+	}
+	if r.allow() {
+		t.Error("expected no tokens")
+	}
+	write("m")
+	r.flush()
+
+	if expected := ">a\n>m\n"; out.String() != expected {
+		t.Errorf("out = %q, want %q", out.String(), expected)
+	}
+	if expected := "b\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"; rejected.String() != expected {
+		t.Errorf("rejected = %q, want %q", rejected.String(), expected)
+	}
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rawLog writes the command's unfiltered stdout to a file (--raw-log),
+// optionally gzip compressed, rotating it once it reaches a maximum size.
+//
+// Errors never interrupt filtering: the first is reported to errOut, after
+// which nothing more is written.
+type rawLog struct {
+	path     string
+	maxSize  int64 // of the uncompressed output, per file, 0 for unlimited
+	maxFiles int   // rotated files to keep, 0 for unlimited
+	compress bool
+	errOut   io.Writer
+	file     *os.File
+	gz       *gzip.Writer
+	w        io.Writer // file, or gz
+	size     int64     // written to the current file, uncompressed
+	rotated  int       // files rotated so far
+	err      error
+}
+
+// openRawLog returns nil if there is no raw log.
+func (x *CLI) openRawLog(errOut io.Writer) (*rawLog, error) {
+	if x.rawLogPath == `` {
+		return nil, nil
+	}
+	r := &rawLog{
+		path:     x.rawLogPath,
+		maxSize:  int64(x.rawLogMaxSize),
+		maxFiles: x.rawLogMaxFiles,
+		compress: x.rawLogGzip,
+		errOut:   errOut,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rawLog) open() error {
+	file, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	r.file, r.w, r.size = file, file, 0
+	if r.compress {
+		r.gz = gzip.NewWriter(file)
+		r.w = r.gz
+	}
+	return nil
+}
+
+// Write writes p, rotating as necessary, and always succeeds, so it may be
+// used with io.TeeReader.
+func (r *rawLog) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) != 0 && r.err == nil {
+		chunk := p
+		if r.maxSize > 0 {
+			if r.size >= r.maxSize {
+				r.fail(r.rotate())
+				continue
+			}
+			chunk = chunk[:min(int64(len(chunk)), r.maxSize-r.size)]
+		}
+		written, err := r.w.Write(chunk)
+		r.size += int64(written)
+		p = p[written:]
+		r.fail(err)
+	}
+	return n, nil
+}
+
+// rotate closes the current file, renaming it, and any previously rotated
+// files, like logrotate, i.e. the most recent is '.1', then opens a new one.
+// Files rotated by a previous run are rotated (or removed) in turn.
+func (r *rawLog) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	if r.rotated == 0 {
+		r.rotated = r.existing()
+	}
+	r.rotated++
+	for r.maxFiles > 0 && r.rotated > r.maxFiles {
+		r.rotated--
+		if err := os.Remove(r.rotatedPath(r.rotated)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	for i := r.rotated; i > 1; i-- {
+		if err := os.Rename(r.rotatedPath(i-1), r.rotatedPath(i)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.rotatedPath(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// existing returns the number of consecutive rotated files, from '.1', e.g.
+// left by a previous run.
+func (r *rawLog) existing() int {
+	n := 0
+	for {
+		if _, err := os.Lstat(r.rotatedPath(n + 1)); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// rotatedPath returns the path of the i-th most recently rotated file, e.g.
+// 'raw.log.1', or 'raw.1.gz', for 'raw.gz'.
+func (r *rawLog) rotatedPath(i int) string {
+	if r.compress {
+		if base, ok := strings.CutSuffix(r.path, `.gz`); ok {
+			return base + `.` + strconv.Itoa(i) + `.gz`
+		}
+	}
+	return r.path + `.` + strconv.Itoa(i)
+}
+
+func (r *rawLog) closeFile() error {
+	var err error
+	if r.gz != nil {
+		err = r.gz.Close()
+		r.gz = nil
+	}
+	if r.file != nil {
+		err = errors.Join(err, r.file.Close())
+		r.file = nil
+	}
+	return err
+}
+
+// fail records err, if it is the first, reporting it.
+func (r *rawLog) fail(err error) {
+	if err == nil || r.err != nil {
+		return
+	}
+	r.err = err
+	_, _ = fmt.Fprintf(r.errOut, "Warning: failed to write --raw-log, it will be incomplete: %s\n", err)
+}
+
+// close flushes and closes the current file.
+func (r *rawLog) close() {
+	if r.file == nil {
+		return
+	}
+	r.fail(r.closeFile())
+}
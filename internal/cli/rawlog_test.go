@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_byteSize(t *testing.T) {
+	for value, expected := range map[string]byteSize{
+		"0":    0,
+		"100":  100,
+		"2k":   2 << 10,
+		"10M":  10 << 20,
+		"1G":   1 << 30,
+		"1536": 1536,
+	} {
+		var got byteSize
+		if err := got.Set(value); err != nil || got != expected {
+			t.Errorf("Set(%q) = %d, %v, want %d", value, got, err, expected)
+		}
+	}
+	for _, value := range []string{"", "-1", "1T", "M", "1.5M", "99999999999G"} {
+		var got byteSize
+		if err := got.Set(value); err == nil {
+			t.Errorf("Set(%q) = %d, want an error", value, got)
+		}
+	}
+	for size, expected := range map[byteSize]string{0: "0", 1536: "1536", 2 << 10: "2K", 3 << 30: "3G"} {
+		if got := size.String(); got != expected {
+			t.Errorf("String() = %q, want %q", got, expected)
+		}
+	}
+}
+
+func readRawLog(t *testing.T, path string, compressed bool) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressed {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err = io.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return string(b)
+}
+
+func Test_rawLog(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cli      CLI
+		path     string
+		existing map[string]string // e.g. left by a previous run
+		expected map[string]string
+	}{
+		{
+			name:     "unlimited",
+			path:     "raw.log",
+			expected: map[string]string{"raw.log": "0123456789abcdefghij"},
+		},
+		{
+			name: "rotated",
+			cli:  CLI{rawLogMaxSize: 6},
+			path: "raw.log",
+			expected: map[string]string{
+				"raw.log":   "ij",
+				"raw.log.1": "cdefgh",
+				"raw.log.2": "6789ab",
+				"raw.log.3": "012345",
+			},
+		},
+		{
+			name: "max files",
+			cli:  CLI{rawLogMaxSize: 6, rawLogMaxFiles: 2},
+			path: "raw.log",
+			expected: map[string]string{
+				"raw.log":   "ij",
+				"raw.log.1": "cdefgh",
+				"raw.log.2": "6789ab",
+			},
+		},
+		{
+			name:     "previous run",
+			cli:      CLI{rawLogMaxSize: 6},
+			path:     "raw.log",
+			existing: map[string]string{"raw.log": "old", "raw.log.1": "old 1", "raw.log.2": "old 2", "raw.log.4": "old 4"},
+			expected: map[string]string{
+				"raw.log":   "ij",
+				"raw.log.1": "cdefgh",
+				"raw.log.2": "6789ab",
+				"raw.log.3": "012345",
+				"raw.log.4": "old 1",
+				"raw.log.5": "old 2",
+			},
+		},
+		{
+			name:     "previous run max files",
+			cli:      CLI{rawLogMaxSize: 6, rawLogMaxFiles: 2},
+			path:     "raw.log",
+			existing: map[string]string{"raw.log.1": "old 1", "raw.log.2": "old 2", "raw.log.3": "old 3", "raw.log.4": "old 4"},
+			expected: map[string]string{
+				"raw.log":   "ij",
+				"raw.log.1": "cdefgh",
+				"raw.log.2": "6789ab",
+			},
+		},
+		{
+			name: "gzip",
+			cli:  CLI{rawLogMaxSize: 10, rawLogGzip: true},
+			path: "raw.gz",
+			expected: map[string]string{
+				"raw.gz":   "abcdefghij",
+				"raw.1.gz": "0123456789",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var errOut bytes.Buffer
+			cli := tc.cli
+			cli.rawLogPath = filepath.Join(dir, tc.path)
+			for name, content := range tc.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r, err := cli.openRawLog(&errOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range []string{"0123", "456789abc", "", "defghij"} {
+				if n, err := r.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			r.close()
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tc.expected) {
+				t.Errorf("got %d files, want %d", len(entries), len(tc.expected))
+			}
+			for name, expected := range tc.expected {
+				if got := readRawLog(t, filepath.Join(dir, name), cli.rawLogGzip); got != expected {
+					t.Errorf("%s = %q, want %q", name, got, expected)
+				}
+			}
+			if errOut.Len() != 0 {
+				t.Errorf("errOut = %q", errOut.String())
+			}
+		})
+	}
+}
+
+func Test_rawLog_error(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&CLI{rawLogPath: filepath.Join(dir, "missing", "raw.log")}).openRawLog(io.Discard); err == nil {
+		t.Error("expected an error")
+	}
+
+	var errOut bytes.Buffer
+	r, err := (&CLI{rawLogPath: filepath.Join(dir, "raw.log"), rawLogMaxSize: 4}).openRawLog(&errOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if n, err := r.Write([]byte("abcdef")); n != 6 || err != nil {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+	r.close()
+	if got := errOut.String(); !strings.HasPrefix(got, "Warning: failed to write --raw-log, it will be incomplete: ") || strings.Count(got, "\n") != 1 {
+		t.Errorf("errOut = %q", got)
+	}
+}
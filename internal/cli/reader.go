@@ -0,0 +1,422 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	newline = []byte{'\n'}
+	crlf    = []byte{'\r', '\n'}
+)
+
+// lineReader reads lines from the command's stdout, like bufio.Scanner, but
+// without a limit on the line length, and retaining the original terminator
+// ("\n", "\r\n", or none, for an unterminated last line). Optionally, a
+// lone "\r" may also be treated as a terminator, splitting lines into
+// segments (e.g. progress updates), or lines may instead be separated by an
+// arbitrary byte string or regex (i.e. records). Lines may also be limited
+// to a maximum length, in which case the remainder of any longer line is left
+// unread, to be discarded or copied by the caller, without buffering it.
+//
+// If the input may end with a partial terminator (e.g. a "\r", which may be
+// followed by "\n"), and it's a pipe, the command is given lookaheadDelay to
+// write more, after which it's treated as idle, as if at EOF, so the line
+// isn't held back indefinitely.
+type lineReader struct {
+	reader         *bufio.Reader
+	pipe           readDeadliner  // the underlying input, if it supports deadlines
+	maxLength      int            // 0 for unlimited
+	crSegments     bool           // a lone "\r" is also a terminator
+	separator      []byte         // replaces the usual terminators, if set
+	separatorRegex *regexp.Regexp // replaces the usual terminators, if set
+	buf            []byte         // the line, including the terminator
+	n              int            // length of the line, excluding the terminator
+	long           bool           // the current line exceeds maxLength
+	rest           bool           // the remainder of the current line is unread
+	err            error
+}
+
+// maxSeparatorMatch is the maximum length of a match of a separatorRegex,
+// that is guaranteed to be found, if it spans multiple reads.
+const maxSeparatorMatch = 4 * 1024
+
+// lookaheadDelay is how long to wait for more input, in order to tell if a
+// partial terminator is complete, before treating the command as idle.
+const lookaheadDelay = 10 * time.Millisecond
+
+// sniffSize is the length of the start of the input returned by sniff.
+const sniffSize = 8 * 1024
+
+// readDeadliner is implemented by *os.File, which supports deadlines for
+// pipes, on most platforms.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+func newLineReader(r io.Reader, maxLength int) *lineReader {
+	x := &lineReader{
+		reader:    bufio.NewReaderSize(r, 64*1024),
+		maxLength: maxLength,
+	}
+	x.pipe, _ = r.(readDeadliner)
+	return x
+}
+
+// scan advances to the next line, returning false at EOF or on error. If the
+// remainder of the previous line was left unread, it is discarded.
+func (x *lineReader) scan() bool {
+	if x.rest {
+		if _, err := x.discardRest(); err != nil {
+			return false
+		}
+	}
+
+	x.buf = x.buf[:0]
+	x.n = 0
+	x.long = false
+
+	for {
+		chunk, ok := x.peek()
+		if !ok {
+			x.n = len(x.buf)
+			return len(x.buf) != 0
+		}
+
+		chunk, take, termLength, ok := x.delimit(chunk)
+		if !ok {
+			continue
+		}
+		found := termLength != 0
+
+		// N.B. a "\r" immediately preceding the "\n" is part of the terminator
+		newlines := x.newlineTerminated()
+		if x.maxLength > 0 && len(x.buf)+take > x.maxLength &&
+			!(newlines && found && len(x.buf)+take-1 == x.maxLength && chunk[take-1] == '\r') {
+			if newlines && !found && len(x.buf)+take-1 == x.maxLength && chunk[take-1] == '\r' {
+				// need the next byte, to tell if the "\r" is part of the terminator
+				if x.lookahead(len(chunk)+1) == nil {
+					continue
+				}
+				// N.B. peeking may have moved the buffered input
+				chunk, _ = x.reader.Peek(x.reader.Buffered())
+			}
+			take = x.maxLength - len(x.buf)
+			x.buf = append(x.buf, chunk[:take]...)
+			_, _ = x.reader.Discard(take)
+			x.n = len(x.buf)
+			x.long = true
+			x.rest = true
+			return true
+		}
+
+		take += termLength
+		x.buf = append(x.buf, chunk[:take]...)
+		_, _ = x.reader.Discard(take)
+
+		if found {
+			x.n = len(x.buf) - termLength
+			if newlines && bytes.HasSuffix(x.buf, crlf) {
+				x.n--
+			}
+			return true
+		}
+	}
+}
+
+// newlineTerminated returns true if lines are terminated by "\n" (or
+// "\r\n"), as opposed to a custom separator.
+func (x *lineReader) newlineTerminated() bool {
+	return x.separator == nil && x.separatorRegex == nil && !x.crSegments
+}
+
+// delimit returns the length of the data at the start of chunk, preceding
+// the first terminator, and the length of that terminator, or 0 if chunk
+// contains no (complete) terminator. In the latter case, the data may be
+// shorter than chunk, if the end of chunk may be the start of a terminator.
+// If more input was buffered, in order to tell, ok will be false, and the
+// caller must peek again. As peeking may move the buffered input, the
+// returned data replaces chunk.
+func (x *lineReader) delimit(chunk []byte) (data []byte, n, termLength int, ok bool) {
+	n, termLength = x.index(chunk, false)
+	if termLength == 0 && n < len(chunk) {
+		err := x.lookahead(len(chunk) + 1)
+		if err == nil {
+			return nil, 0, 0, false
+		}
+		chunk, _ = x.reader.Peek(x.reader.Buffered())
+		if !errors.Is(err, bufio.ErrBufferFull) || n == 0 {
+			// no more input (for now), or no way to get it
+			n, termLength = x.index(chunk, true)
+		}
+	}
+	return chunk, n, termLength, true
+}
+
+// lookahead peeks at the next n bytes, reading more if necessary, waiting at
+// most lookaheadDelay, if the input is a pipe. It returns nil if they were
+// read, or the error, which is os.ErrDeadlineExceeded if the command is
+// idle. Any error isn't retained, unlike peek, as scanning may continue.
+func (x *lineReader) lookahead(n int) error {
+	if x.pipe != nil && x.pipe.SetReadDeadline(time.Now().Add(lookaheadDelay)) == nil {
+		defer func() { _ = x.pipe.SetReadDeadline(time.Time{}) }()
+	}
+	_, err := x.reader.Peek(n)
+	return err
+}
+
+// wait waits at most d for more input, if the input is a pipe, returning
+// false if the command is still idle. Like lookahead, any error isn't
+// retained.
+func (x *lineReader) wait(d time.Duration) bool {
+	if x.ready() || x.pipe == nil || x.pipe.SetReadDeadline(time.Now().Add(d)) != nil {
+		return true
+	}
+	defer func() { _ = x.pipe.SetReadDeadline(time.Time{}) }()
+	_, err := x.reader.Peek(1)
+	return !errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// index implements delimit, for the given chunk, where atEOF indicates
+// there is no more input, so any potential terminator must be treated as
+// complete (or not a terminator).
+func (x *lineReader) index(chunk []byte, atEOF bool) (n, termLength int) {
+	switch {
+	case x.separatorRegex != nil:
+		loc := x.separatorRegex.FindIndex(chunk)
+		switch {
+		case loc == nil && atEOF:
+			return len(chunk), 0
+		case loc == nil:
+			return max(0, len(chunk)-maxSeparatorMatch), 0
+		case loc[1] == len(chunk) && !atEOF:
+			// the match may be longer, given more input
+			return loc[0], 0
+		default:
+			return loc[0], loc[1] - loc[0]
+		}
+
+	case x.separator != nil:
+		if i := bytes.Index(chunk, x.separator); i >= 0 {
+			return i, len(x.separator)
+		}
+		if atEOF {
+			return len(chunk), 0
+		}
+		return len(chunk) - partialSuffix(chunk, x.separator), 0
+
+	case x.crSegments:
+		i := bytes.IndexAny(chunk, "\r\n")
+		switch {
+		case i < 0:
+			return len(chunk), 0
+		case chunk[i] == '\n':
+			return i, 1
+		case i+1 < len(chunk):
+			return i, terminatorLength(chunk[i:])
+		case atEOF:
+			return i, 1
+		default:
+			// need the next byte, to tell if it's "\r\n"
+			return i, 0
+		}
+
+	default:
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			return i, 1
+		}
+		return len(chunk), 0
+	}
+}
+
+// partialSuffix returns the length of the longest suffix of b that is a
+// (proper) prefix of sep.
+func partialSuffix(b, sep []byte) int {
+	for n := min(len(b), len(sep)-1); n > 0; n-- {
+		if bytes.HasSuffix(b, sep[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// terminatorLength returns the length of the terminator at the start of b.
+func terminatorLength(b []byte) int {
+	if bytes.HasPrefix(b, crlf) {
+		return len(crlf)
+	}
+	return 1
+}
+
+// peek returns whatever is buffered, reading more if necessary, or false on
+// EOF or error.
+func (x *lineReader) peek() ([]byte, bool) {
+	if x.err != nil {
+		return nil, false
+	}
+	if x.reader.Buffered() == 0 {
+		if _, err := x.reader.Peek(1); err != nil {
+			x.err = err
+			return nil, false
+		}
+	}
+	chunk, _ := x.reader.Peek(x.reader.Buffered())
+	return chunk, true
+}
+
+// ready returns true if the next line is buffered in full (or at EOF), i.e.
+// the next scan won't read, and block. It may return false negatives.
+func (x *lineReader) ready() bool {
+	if x.err != nil {
+		return true
+	}
+	n := x.reader.Buffered()
+	if n == 0 || x.rest {
+		return false
+	}
+	if x.maxLength > 0 && n > x.maxLength {
+		return true
+	}
+	chunk, _ := x.reader.Peek(n)
+	_, termLength := x.index(chunk, false)
+	return termLength != 0
+}
+
+// sniff returns the start of the input, without consuming it, i.e. at least
+// sniffSize bytes, unless there's less input, or the command is idle (see
+// lookahead) prior to writing that much. It must be called prior to scan.
+func (x *lineReader) sniff() []byte {
+	chunk, ok := x.peek()
+	for ok && len(chunk) < sniffSize && x.lookahead(len(chunk)+1) == nil {
+		chunk, _ = x.reader.Peek(x.reader.Buffered())
+	}
+	// N.B. peeking may have moved the buffered input
+	chunk, _ = x.reader.Peek(x.reader.Buffered())
+	return chunk
+}
+
+// copyAll copies all remaining input to w, bypassing the line scanning,
+// returning the number of bytes copied. As with copyRest, errors writing to
+// w are not reported.
+func (x *lineReader) copyAll(w io.Writer) (int64, error) {
+	var n int64
+	for {
+		chunk, ok := x.peek()
+		if !ok {
+			break
+		}
+		_, _ = w.Write(chunk)
+		n += int64(len(chunk))
+		_, _ = x.reader.Discard(len(chunk))
+	}
+	return n, x.Err()
+}
+
+// looksBinary returns true if b contains a NUL byte, or invalid UTF-8 (other
+// than an incomplete rune at the end).
+func looksBinary(b []byte) bool {
+	if bytes.IndexByte(b, 0) >= 0 {
+		return true
+	}
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return utf8.FullRune(b[i:])
+		}
+		i += size
+	}
+	return false
+}
+
+// bytes returns the current line, excluding the terminator, valid until the
+// next call to scan. For long lines, it contains only the first maxLength
+// bytes.
+func (x *lineReader) bytes() []byte {
+	return x.buf[:x.n]
+}
+
+// terminator returns the terminator of the current line, which is "\n",
+// "\r\n", "\r" (only with crSegments), the separator, or empty for the last
+// line, if it wasn't terminated. It is not valid for long lines, until the
+// remainder has been read.
+func (x *lineReader) terminator() []byte {
+	return x.buf[x.n:]
+}
+
+// line returns the current line, including the terminator, i.e. exactly as
+// it was read (other than any remainder, for long lines).
+func (x *lineReader) line() []byte {
+	return x.buf
+}
+
+// discardRest discards the unread remainder of a long line, returning the
+// number of bytes discarded, excluding the terminator.
+func (x *lineReader) discardRest() (int64, error) {
+	return x.copyRest(io.Discard)
+}
+
+// copyRest copies the unread remainder of a long line to w, excluding the
+// terminator, returning the number of bytes copied. Errors writing to w are
+// not reported, as the remainder must be consumed, regardless.
+func (x *lineReader) copyRest(w io.Writer) (int64, error) {
+	var (
+		n  int64
+		cr bool // a "\r" was withheld, as it may be part of the terminator
+	)
+	for x.rest {
+		chunk, ok := x.peek()
+		if !ok {
+			x.rest = false
+			break
+		}
+
+		chunk, take, termLength, ok := x.delimit(chunk)
+		if !ok {
+			continue
+		}
+		found := termLength != 0
+
+		data := chunk[:take]
+		if cr && (len(data) != 0 || !found) {
+			_, _ = w.Write(crlf[:1])
+			n++
+			cr = false
+		}
+		if x.newlineTerminated() && len(data) != 0 && data[len(data)-1] == '\r' {
+			data = data[:len(data)-1]
+			cr = true
+		}
+		_, _ = w.Write(data)
+		n += int64(len(data))
+
+		if found {
+			if cr {
+				x.buf = append(x.buf, '\r')
+			}
+			x.buf = append(x.buf, chunk[take:take+termLength]...)
+			cr = false
+			x.rest = false
+			take += termLength
+		}
+		_, _ = x.reader.Discard(take)
+	}
+	if cr {
+		_, _ = w.Write(crlf[:1])
+		n++
+	}
+	return n, x.Err()
+}
+
+// Err returns the first non-EOF error encountered.
+func (x *lineReader) Err() error {
+	if errors.Is(x.err, io.EOF) {
+		return nil
+	}
+	return x.err
+}
@@ -0,0 +1,552 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func Test_lineReader_scan(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+
+	for _, tc := range [...]struct {
+		name     string
+		input    string
+		expected []string
+		terms    []string
+	}{
+		{"empty", "", nil, nil},
+		{"single line", "hello\n", []string{"hello"}, []string{"\n"}},
+		{"no final newline", "hello\nworld", []string{"hello", "world"}, []string{"\n", ""}},
+		{"empty lines", "\n\na\n\n", []string{"", "", "a", ""}, []string{"\n", "\n", "\n", "\n"}},
+		{"crlf", "a\r\nb\r\n", []string{"a", "b"}, []string{"\r\n", "\r\n"}},
+		{"mixed terminators", "a\r\nb\nc\r\r\nd\re\r", []string{"a", "b", "c\r", "d\re\r"}, []string{"\r\n", "\n", "\r\n", ""}},
+		{"longer than scanner limit", "a\n" + long + "\nb\n", []string{"a", long, "b"}, []string{"\n", "\n", "\n"}},
+		{"long final line", long, []string{long}, []string{""}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := newLineReader(strings.NewReader(tc.input), 0)
+			var lines, terms []string
+			for reader.scan() {
+				if reader.long {
+					t.Fatal("unexpected long line")
+				}
+				lines = append(lines, string(reader.bytes()))
+				terms = append(terms, string(reader.terminator()))
+				if string(reader.line()) != lines[len(lines)-1]+terms[len(terms)-1] {
+					t.Errorf("line() = %q, want %q", reader.line(), lines[len(lines)-1]+terms[len(terms)-1])
+				}
+			}
+			if err := reader.Err(); err != nil {
+				t.Fatalf("Err() = %v", err)
+			}
+			if len(lines) != len(tc.expected) {
+				t.Fatalf("got %d lines, want %d", len(lines), len(tc.expected))
+			}
+			for i := range lines {
+				if lines[i] != tc.expected[i] || terms[i] != tc.terms[i] {
+					t.Errorf("line %d = %.20q (terminator %q), want %.20q (terminator %q)", i, lines[i], terms[i], tc.expected[i], tc.terms[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_lineReader_maxLength(t *testing.T) {
+	long := strings.Repeat("y", 100*1024)
+	input := "short\n" + "abcdefghij\n" + "abcde\n" + long + "\n" + "tail" + long
+
+	t.Run("discard automatically", func(t *testing.T) {
+		reader := newLineReader(strings.NewReader(input), 5)
+		var lines []string
+		var longs []bool
+		for reader.scan() {
+			lines = append(lines, string(reader.bytes()))
+			longs = append(longs, reader.long)
+		}
+		if err := reader.Err(); err != nil {
+			t.Fatalf("Err() = %v", err)
+		}
+		expected := []string{"short", "abcde", "abcde", "yyyyy", "taily"}
+		expectedLongs := []bool{false, true, false, true, true}
+		if len(lines) != len(expected) {
+			t.Fatalf("got lines %q, want %q", lines, expected)
+		}
+		for i := range expected {
+			if lines[i] != expected[i] || longs[i] != expectedLongs[i] {
+				t.Errorf("line %d = %q (long %v), want %q (long %v)", i, lines[i], longs[i], expected[i], expectedLongs[i])
+			}
+		}
+	})
+
+	t.Run("copy and discard", func(t *testing.T) {
+		reader := newLineReader(strings.NewReader(input), 5)
+
+		if !reader.scan() || reader.long {
+			t.Fatal("expected a short line")
+		}
+
+		if !reader.scan() || !reader.long {
+			t.Fatal("expected a long line")
+		}
+		var rest bytes.Buffer
+		if n, err := reader.copyRest(&rest); err != nil || n != 5 || rest.String() != "fghij" || string(reader.terminator()) != "\n" {
+			t.Fatalf("copyRest() = %d, %v, %q, terminator %q", n, err, rest.String(), reader.terminator())
+		}
+
+		if !reader.scan() || reader.long || string(reader.bytes()) != "abcde" {
+			t.Fatalf("expected a line exactly the max length, got %q", reader.bytes())
+		}
+
+		if !reader.scan() || !reader.long {
+			t.Fatal("expected a long line")
+		}
+		if n, err := reader.discardRest(); err != nil || n != int64(len(long)-5) {
+			t.Fatalf("discardRest() = %d, %v", n, err)
+		}
+
+		if !reader.scan() || !reader.long {
+			t.Fatal("expected a long line")
+		}
+		rest.Reset()
+		if n, err := reader.copyRest(&rest); err != nil || n != int64(len(long)-1) || len(reader.terminator()) != 0 {
+			t.Fatalf("copyRest() = %d, %v, terminator %q", n, err, reader.terminator())
+		}
+
+		if reader.scan() {
+			t.Fatalf("unexpected line %q", reader.bytes())
+		}
+	})
+}
+
+func Test_lineReader_maxLength_crlf(t *testing.T) {
+	for _, tc := range [...]struct {
+		name   string
+		reader func(string) io.Reader
+	}{
+		{"buffered", func(s string) io.Reader { return strings.NewReader(s) }},
+		{"one byte at a time", func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			input := "abc\r\n" + "abcd\r\n" + "abcdef\r\n" + "abcdefg\r\r\n" + "abcd\r" + "abcd\re\r"
+			reader := newLineReader(tc.reader(input), 3)
+
+			type result struct {
+				line string
+				long bool
+				rest string
+				term string
+			}
+			var results []result
+			for reader.scan() {
+				r := result{line: string(reader.bytes()), long: reader.long}
+				if reader.long {
+					var rest bytes.Buffer
+					n, err := reader.copyRest(&rest)
+					if err != nil || n != int64(rest.Len()) {
+						t.Fatalf("copyRest() = %d, %v (copied %d)", n, err, rest.Len())
+					}
+					r.rest = rest.String()
+				}
+				r.term = string(reader.terminator())
+				results = append(results, r)
+			}
+
+			expected := []result{
+				{line: "abc", term: "\r\n"},
+				{line: "abc", long: true, rest: "d", term: "\r\n"},
+				{line: "abc", long: true, rest: "def", term: "\r\n"},
+				{line: "abc", long: true, rest: "defg\r", term: "\r\n"},
+				{line: "abc", long: true, rest: "d\rabcd\re\r", term: ""},
+			}
+			if len(results) != len(expected) {
+				t.Fatalf("got %+v, want %+v", results, expected)
+			}
+			for i := range expected {
+				if results[i] != expected[i] {
+					t.Errorf("line %d = %+v, want %+v", i, results[i], expected[i])
+				}
+			}
+		})
+	}
+}
+
+// readAll reads every line from reader, copying the remainder of any long
+// lines, returning the input, as read.
+func readAll(t *testing.T, reader *lineReader) string {
+	t.Helper()
+	var b bytes.Buffer
+	for reader.scan() {
+		b.Write(reader.bytes())
+		if reader.long {
+			if _, err := reader.copyRest(&b); err != nil {
+				t.Fatalf("copyRest() error = %v", err)
+			}
+		}
+		b.Write(reader.terminator())
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	return b.String()
+}
+
+func Test_lineReader_maxLength_crAtEOF(t *testing.T) {
+	// N.B. the first line is consumed, so peeking for the byte following the
+	// "\r" moves the buffered input
+	for _, input := range [...]string{"1\n0123\r", "1\n012\r", "12\n0123\r\n", "1\n0123\r\r"} {
+		reader := newLineReader(strings.NewReader(input), 4)
+		if got := readAll(t, reader); got != input {
+			t.Errorf("got %q, want %q", got, input)
+		}
+	}
+}
+
+func Test_lineReader_crSegments(t *testing.T) {
+	for _, tc := range [...]struct {
+		name   string
+		reader func(string) io.Reader
+	}{
+		{"buffered", func(s string) io.Reader { return strings.NewReader(s) }},
+		{"one byte at a time", func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			input := "10%\r20%\r\r100%\r\ndone\nlast\r"
+			reader := newLineReader(tc.reader(input), 0)
+			reader.crSegments = true
+
+			var lines, terms []string
+			for reader.scan() {
+				lines = append(lines, string(reader.bytes()))
+				terms = append(terms, string(reader.terminator()))
+			}
+			if err := reader.Err(); err != nil {
+				t.Fatalf("Err() = %v", err)
+			}
+
+			expectedLines := []string{"10%", "20%", "", "100%", "done", "last"}
+			expectedTerms := []string{"\r", "\r", "\r", "\r\n", "\n", "\r"}
+			if len(lines) != len(expectedLines) {
+				t.Fatalf("got %q (terminators %q), want %q", lines, terms, expectedLines)
+			}
+			for i := range lines {
+				if lines[i] != expectedLines[i] || terms[i] != expectedTerms[i] {
+					t.Errorf("segment %d = %q (terminator %q), want %q (terminator %q)", i, lines[i], terms[i], expectedLines[i], expectedTerms[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_lineReader_crSegments_crAtEOF(t *testing.T) {
+	// N.B. peeking for the byte after the "\r" moves the buffered input
+	reader := newLineReader(strings.NewReader("1\n0123456789\r"), 0)
+	reader.crSegments = true
+
+	var lines []string
+	for reader.scan() {
+		lines = append(lines, string(reader.line()))
+	}
+	if len(lines) != 2 || lines[0] != "1\n" || lines[1] != "0123456789\r" {
+		t.Errorf("got %q", lines)
+	}
+}
+
+func Test_lineReader_crSegments_idle(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	reader := newLineReader(r, 0)
+	reader.crSegments = true
+
+	// N.B. the "\r" isn't held back, pending the next write
+	if _, err := w.WriteString("x\na\r"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range [...]string{"x\n", "a\r"} {
+		if !reader.scan() || string(reader.line()) != expected {
+			t.Fatalf("got %q, want %q", reader.line(), expected)
+		}
+	}
+
+	if _, err := w.WriteString("b\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	if !reader.scan() || string(reader.line()) != "b\r\n" {
+		t.Fatalf("got %q", reader.line())
+	}
+	if reader.scan() {
+		t.Fatalf("unexpected line %q", reader.line())
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+}
+
+func Test_lineReader_separator(t *testing.T) {
+	long := strings.Repeat("z", 100*1024)
+
+	for _, tc := range [...]struct {
+		name      string
+		separator string
+		regex     string
+		input     string
+		expected  []string
+		terms     []string
+	}{
+		{"nul", "\x00", "", "a\x00b\nc\x00\x00d", []string{"a", "b\nc", "", "d"}, []string{"\x00", "\x00", "\x00", ""}},
+		{"nul ignores crlf", "\x00", "", "a\r\n\x00b\r", []string{"a\r\n", "b\r"}, []string{"\x00", ""}},
+		{"multi byte", "--", "", "a-b--c---d-", []string{"a-b", "c", "-d-"}, []string{"--", "--", ""}},
+		{"multi byte long", "\n---\n", "", long + "\n---\n" + long + "\n--", []string{long, long + "\n--"}, []string{"\n---\n", ""}},
+		{"regex", "", `;+`, "a;b;;;c;", []string{"a", "b", "c"}, []string{";", ";;;", ";"}},
+		{"regex long", "", `\n-+\n`, long + "\n--\n" + long + "\n-", []string{long, long + "\n-"}, []string{"\n--\n", ""}},
+	} {
+		for _, r := range [...]struct {
+			name   string
+			reader func(string) io.Reader
+		}{
+			{"buffered", func(s string) io.Reader { return strings.NewReader(s) }},
+			{"one byte at a time", func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }},
+		} {
+			t.Run(tc.name+" "+r.name, func(t *testing.T) {
+				reader := newLineReader(r.reader(tc.input), 0)
+				if tc.separator != "" {
+					reader.separator = []byte(tc.separator)
+				}
+				if tc.regex != "" {
+					reader.separatorRegex = regexp.MustCompile(tc.regex)
+				}
+
+				var lines, terms []string
+				for reader.scan() {
+					lines = append(lines, string(reader.bytes()))
+					terms = append(terms, string(reader.terminator()))
+				}
+				if err := reader.Err(); err != nil {
+					t.Fatalf("Err() = %v", err)
+				}
+				if len(lines) != len(tc.expected) {
+					t.Fatalf("got %.50q (terminators %q), want %.50q", lines, terms, tc.expected)
+				}
+				for i := range lines {
+					if lines[i] != tc.expected[i] || terms[i] != tc.terms[i] {
+						t.Errorf("record %d = %.20q (terminator %q), want %.20q (terminator %q)", i, lines[i], terms[i], tc.expected[i], tc.terms[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func Test_lineReader_separator_maxLength(t *testing.T) {
+	reader := newLineReader(iotest.OneByteReader(strings.NewReader("abcdef--ab--abc-x--")), 3)
+	reader.separator = []byte("--")
+
+	var lines []string
+	var rest bytes.Buffer
+	for reader.scan() {
+		if reader.long {
+			rest.Reset()
+			if _, err := reader.copyRest(&rest); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lines = append(lines, string(reader.bytes())+"|"+rest.String()+"|"+string(reader.terminator()))
+		rest.Reset()
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"abc|def|--", "ab||--", "abc|-x|--"}; strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %q, want %q", lines, expected)
+	}
+}
+
+func Test_lineReader_passthrough(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	inputs := []string{"1ab0123456789a", "1x0123456789x", "1\n0123456789\r"}
+	for range 500 {
+		b := make([]byte, rng.IntN(40))
+		for i := range b {
+			b[i] = "abxy\r\n0"[rng.IntN(7)]
+		}
+		inputs = append(inputs, string(b))
+	}
+
+	for _, tc := range [...]struct {
+		name  string
+		setup func(*lineReader)
+	}{
+		{"newlines", func(*lineReader) {}},
+		{"cr segments", func(x *lineReader) { x.crSegments = true }},
+		{"separator", func(x *lineReader) { x.separator = []byte("ab") }},
+		{"regex", func(x *lineReader) { x.separatorRegex = regexp.MustCompile(`x+y`) }},
+	} {
+		for _, r := range [...]struct {
+			name   string
+			reader func(string) io.Reader
+		}{
+			{"buffered", func(s string) io.Reader { return strings.NewReader(s) }},
+			{"one byte at a time", func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }},
+			{"half at a time", func(s string) io.Reader { return iotest.HalfReader(strings.NewReader(s)) }},
+		} {
+			for _, maxLength := range [...]int{0, 3} {
+				t.Run(fmt.Sprint(tc.name, " ", r.name, " ", maxLength), func(t *testing.T) {
+					for _, input := range inputs {
+						reader := newLineReader(r.reader(input), maxLength)
+						tc.setup(reader)
+						if got := readAll(t, reader); got != input {
+							t.Fatalf("got %q, want %q", got, input)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func Test_lineReader_separatorRegex_idle(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	reader := newLineReader(r, 0)
+	reader.separatorRegex = regexp.MustCompile(`\n-+\n`)
+
+	// N.B. the match ends with the input, but isn't held back, pending the
+	// next write
+	if _, err := w.WriteString("a\n--\n"); err != nil {
+		t.Fatal(err)
+	}
+	if !reader.scan() || string(reader.bytes()) != "a" || string(reader.terminator()) != "\n--\n" {
+		t.Fatalf("got %q", reader.line())
+	}
+
+	if _, err := w.WriteString("b\n-"); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	if !reader.scan() || string(reader.line()) != "b\n-" {
+		t.Fatalf("got %q", reader.line())
+	}
+	if reader.scan() {
+		t.Fatalf("unexpected line %q", reader.line())
+	}
+}
+
+func Test_lineReader_crSegments_maxLength(t *testing.T) {
+	for _, tc := range [...]struct {
+		name   string
+		reader func(string) io.Reader
+	}{
+		{"buffered", func(s string) io.Reader { return strings.NewReader(s) }},
+		{"one byte at a time", func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := newLineReader(tc.reader("abcdef\rab\r\nabcd\r\nabcdefg"), 2)
+			reader.crSegments = true
+
+			var got []string
+			for reader.scan() {
+				line := string(reader.bytes())
+				if reader.long {
+					var rest bytes.Buffer
+					if _, err := reader.copyRest(&rest); err != nil {
+						t.Fatalf("copyRest() error = %v", err)
+					}
+					line += "|" + rest.String()
+				}
+				got = append(got, line+string(reader.terminator()))
+			}
+
+			expected := []string{"ab|cdef\r", "ab\r\n", "ab|cd\r\n", "ab|cdefg"}
+			if len(got) != len(expected) {
+				t.Fatalf("got %q, want %q", got, expected)
+			}
+			for i := range expected {
+				if got[i] != expected[i] {
+					t.Errorf("segment %d = %q, want %q", i, got[i], expected[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_looksBinary(t *testing.T) {
+	for _, tc := range [...]struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"empty", "", false},
+		{"ascii", "hello\nworld\n", false},
+		{"utf-8", "héllo wörld ✓\n", false},
+		{"nul", "hello\x00world", true},
+		{"invalid utf-8", "hello \xff world", true},
+		{"truncated rune at end", "hello \xe2\x9c", false},
+		{"truncated rune in middle", "hello \xe2\x9c world", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := looksBinary([]byte(tc.input)); got != tc.expected {
+				t.Errorf("looksBinary(%q) = %v, want %v", tc.input, got, tc.expected)
+			}
+		})
+	}
+}
+
+func Test_lineReader_sniff(t *testing.T) {
+	// N.B. not just the first read
+	reader := newLineReader(iotest.OneByteReader(strings.NewReader("a\nb\n")), 0)
+	if got := string(reader.sniff()); got != "a\nb\n" {
+		t.Fatalf("sniff() = %q", got)
+	}
+	var lines []string
+	for reader.scan() {
+		lines = append(lines, string(reader.line()))
+	}
+	if len(lines) != 2 || lines[0] != "a\n" || lines[1] != "b\n" {
+		t.Errorf("expected sniff not to consume input, got %q", lines)
+	}
+}
+
+func Test_lineReader_sniff_bounded(t *testing.T) {
+	input := strings.Repeat("x", 3*sniffSize)
+	reader := newLineReader(iotest.OneByteReader(strings.NewReader(input)), 0)
+	if got := len(reader.sniff()); got != sniffSize {
+		t.Fatalf("sniff() returned %d bytes", got)
+	}
+	if got := readAll(t, reader); got != input {
+		t.Errorf("expected sniff not to consume input, got %d bytes", len(got))
+	}
+}
+
+func Test_lineReader_sniff_idle(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	reader := newLineReader(r, 0)
+	if _, err := w.WriteString("a\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(reader.sniff()); got != "a\n" {
+		t.Fatalf("sniff() = %q", got)
+	}
+}
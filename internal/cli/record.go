@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxRecordLines bounds the number of lines buffered for a multi-line
+// record, after which the lines are handled as a record of their own.
+const maxRecordLines = 10000
+
+// recordIdleDelay is how long the command may be idle, after which the
+// current multi-line record is treated as complete, so it's written.
+const recordIdleDelay = 100 * time.Millisecond
+
+// recordRecognizer recognizes lines continuing a multi-line record, e.g. a
+// stack trace. Recognizers may be stateful, and are called for every line.
+type recordRecognizer interface {
+	// start is called with the first line of each record.
+	start(line []byte)
+	// continues returns true if line continues the current record.
+	continues(line []byte) bool
+}
+
+// recordRecognizers are the available recognizers, by name.
+var recordRecognizers = map[string]func() recordRecognizer{
+	`indent`: func() recordRecognizer { return indentRecognizer{} },
+	`go`:     func() recordRecognizer { return &goRecognizer{} },
+	`java`:   func() recordRecognizer { return javaRecognizer{} },
+	`python`: func() recordRecognizer { return &pythonRecognizer{} },
+}
+
+// recordRecognizerNames are the names accepted by --multiline, in order.
+var recordRecognizerNames = []string{`indent`, `go`, `java`, `python`}
+
+// newRecordRecognizers returns new recognizers for the given names, where
+// "all" means all of them, or an error if any name is unknown.
+func newRecordRecognizers(names []string) ([]recordRecognizer, error) {
+	var (
+		recognizers []recordRecognizer
+		seen        = make(map[string]bool)
+	)
+	for _, name := range names {
+		expanded := []string{name}
+		if name == `all` {
+			expanded = recordRecognizerNames
+		}
+		for _, name := range expanded {
+			factory, ok := recordRecognizers[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown multiline recognizer %q (expected %s, or all)", name, strings.Join(recordRecognizerNames, ", "))
+			}
+			if !seen[name] {
+				seen[name] = true
+				recognizers = append(recognizers, factory())
+			}
+		}
+	}
+	return recognizers, nil
+}
+
+// recordGrouper groups lines into multi-line records, which are kept or
+// suppressed as a unit, where a record matches if any of its lines match.
+type recordGrouper struct {
+	recognizers []recordRecognizer
+	lines       [][]byte // reused, only the first n are valid
+	infos       []lineInfo
+	n           int
+	matched     bool // any line of the record matched
+}
+
+// starts returns true if line starts a new record, in which case the
+// current record must be flushed, prior to adding line.
+func (g *recordGrouper) starts(line []byte) bool {
+	var continues bool
+	for _, r := range g.recognizers {
+		// N.B. all recognizers must see every line, to track their state
+		if r.continues(line) {
+			continues = true
+		}
+	}
+	if continues {
+		return false
+	}
+	for _, r := range g.recognizers {
+		r.start(line)
+	}
+	return true
+}
+
+// add adds a copy of line to the current record, returning true if the
+// record is full, and must be flushed.
+func (g *recordGrouper) add(line []byte, info lineInfo, matched bool) bool {
+	if g.n == len(g.lines) {
+		g.lines = append(g.lines, nil)
+		g.infos = append(g.infos, lineInfo{})
+	}
+	g.lines[g.n] = append(g.lines[g.n][:0], line...)
+	g.infos[g.n] = info
+	g.n++
+	g.matched = g.matched || matched
+	return g.n >= maxRecordLines
+}
+
+// flush calls fn with each line of the current record, and whether any of
+// them matched, then resets it.
+func (g *recordGrouper) flush(fn func(line []byte, info lineInfo, matched bool)) {
+	for i, line := range g.lines[:g.n] {
+		fn(line, g.infos[i], g.matched)
+	}
+	g.n = 0
+	g.matched = false
+}
+
+// indentRecognizer continues records with indented lines.
+type indentRecognizer struct{}
+
+func (indentRecognizer) start([]byte) {}
+
+func (indentRecognizer) continues(line []byte) bool {
+	return len(line) != 0 && (line[0] == ' ' || line[0] == '\t')
+}
+
+var (
+	goDumpStartRegex = regexp.MustCompile(`^(?:panic: |fatal error: |goroutine \d+ \[)`)
+	goFrameRegex     = regexp.MustCompile(`^(?:goroutine \d+ \[|created by |panic\(|\[signal |[\w./*()-]+\(.*\)$)`)
+)
+
+// goRecognizer continues Go panics and goroutine dumps, e.g.
+//
+//	panic: boom
+//
+//	goroutine 1 [running]:
+//	main.main()
+//		/tmp/main.go:4 +0x25
+type goRecognizer struct {
+	dump bool
+}
+
+func (x *goRecognizer) start(line []byte) {
+	x.dump = goDumpStartRegex.Match(line)
+}
+
+func (x *goRecognizer) continues(line []byte) bool {
+	if !x.dump {
+		return false
+	}
+	return len(line) == 0 || line[0] == '\t' || goFrameRegex.Match(line)
+}
+
+var javaContinuationRegex = regexp.MustCompile(`^(?:\s+at |Caused by: |\s+\.\.\. \d+ (?:more|common frames omitted)|\s+Suppressed: )`)
+
+// javaRecognizer continues Java stack traces, e.g.
+//
+//	java.lang.IllegalStateException: boom
+//		at Main.main(Main.java:3)
+//	Caused by: java.lang.NullPointerException
+//		... 1 more
+type javaRecognizer struct{}
+
+func (javaRecognizer) start([]byte) {}
+
+func (javaRecognizer) continues(line []byte) bool {
+	return javaContinuationRegex.Match(line)
+}
+
+type pythonState int
+
+const (
+	pythonNone pythonState = iota
+	pythonFrames
+	pythonChained
+)
+
+var (
+	pythonTracebackPrefix = []byte(`Traceback (most recent call last):`)
+	pythonChainLines      = [...][]byte{
+		[]byte(`During handling of the above exception, another exception occurred:`),
+		[]byte(`The above exception was the direct cause of the following exception:`),
+	}
+)
+
+// pythonRecognizer continues Python tracebacks, including the exception
+// line, and any chained exceptions, e.g.
+//
+//	Traceback (most recent call last):
+//	  File "main.py", line 1, in <module>
+//	ValueError: boom
+type pythonRecognizer struct {
+	state pythonState
+}
+
+func (x *pythonRecognizer) start(line []byte) {
+	x.state = pythonNone
+	if bytes.HasPrefix(line, pythonTracebackPrefix) {
+		x.state = pythonFrames
+	}
+}
+
+func (x *pythonRecognizer) continues(line []byte) bool {
+	switch x.state {
+	case pythonFrames:
+		if len(line) == 0 || (line[0] != ' ' && line[0] != '\t') {
+			// the exception line ends the traceback, though it may be chained
+			x.state = pythonChained
+		}
+		return true
+
+	case pythonChained:
+		if bytes.HasPrefix(line, pythonTracebackPrefix) {
+			x.state = pythonFrames
+			return true
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			return true
+		}
+		for _, chain := range pythonChainLines {
+			if bytes.Equal(line, chain) {
+				return true
+			}
+		}
+		return false
+
+	default:
+		return false
+	}
+}
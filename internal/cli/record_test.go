@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// groupRecords groups the lines of input, returning each record, joined by
+// newlines.
+func groupRecords(t *testing.T, names []string, input string) []string {
+	t.Helper()
+	recognizers, err := newRecordRecognizers(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := recordGrouper{recognizers: recognizers}
+	var (
+		records []string
+		record  []string
+	)
+	flush := func() {
+		g.flush(func(line []byte, info lineInfo, matched bool) {
+			record = append(record, string(line))
+		})
+		if record != nil {
+			records = append(records, strings.Join(record, "\n"))
+			record = nil
+		}
+	}
+	for _, line := range strings.Split(input, "\n") {
+		if g.starts([]byte(line)) {
+			flush()
+		}
+		g.add([]byte(line), lineInfo{}, false)
+	}
+	flush()
+	return records
+}
+
+func Test_recordGrouper(t *testing.T) {
+	for _, tc := range [...]struct {
+		name     string
+		names    []string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "indent",
+			names:    []string{"indent"},
+			input:    "--- FAIL: TestA (0.00s)\n    a_test.go:1: boom\n\tmore\nok\n  orphan",
+			expected: []string{"--- FAIL: TestA (0.00s)\n    a_test.go:1: boom\n\tmore", "ok\n  orphan"},
+		},
+		{
+			name:  "go",
+			names: []string{"go"},
+			input: "before\npanic: boom [recovered]\n\tpanic: boom\n\ngoroutine 1 [running]:\nmain.(*T).f(0xc000010000, {0x1, 0x2})\n\t/tmp/main.go:4 +0x25\nmain.main()\n\t/tmp/main.go:8 +0x1d\ncreated by main.init\nexit status 2",
+			expected: []string{
+				"before",
+				"panic: boom [recovered]\n\tpanic: boom\n\ngoroutine 1 [running]:\nmain.(*T).f(0xc000010000, {0x1, 0x2})\n\t/tmp/main.go:4 +0x25\nmain.main()\n\t/tmp/main.go:8 +0x1d\ncreated by main.init",
+				"exit status 2",
+			},
+		},
+		{
+			name:     "go indented without dump",
+			names:    []string{"go"},
+			input:    "a\n\tb",
+			expected: []string{"a", "\tb"},
+		},
+		{
+			name:  "java",
+			names: []string{"java"},
+			input: "Exception in thread \"main\" java.lang.IllegalStateException: boom\n\tat Main.main(Main.java:3)\nCaused by: java.lang.NullPointerException\n\tat Main.f(Main.java:7)\n\t... 1 more\nnext",
+			expected: []string{
+				"Exception in thread \"main\" java.lang.IllegalStateException: boom\n\tat Main.main(Main.java:3)\nCaused by: java.lang.NullPointerException\n\tat Main.f(Main.java:7)\n\t... 1 more",
+				"next",
+			},
+		},
+		{
+			name:  "python",
+			names: []string{"python"},
+			input: "Traceback (most recent call last):\n  File \"a.py\", line 1, in <module>\n    f()\nKeyError: 'x'\n\nDuring handling of the above exception, another exception occurred:\n\nTraceback (most recent call last):\n  File \"a.py\", line 3, in <module>\nValueError: boom\nnext\n  indented",
+			expected: []string{
+				"Traceback (most recent call last):\n  File \"a.py\", line 1, in <module>\n    f()\nKeyError: 'x'\n\nDuring handling of the above exception, another exception occurred:\n\nTraceback (most recent call last):\n  File \"a.py\", line 3, in <module>\nValueError: boom",
+				"next",
+				"  indented",
+			},
+		},
+		{
+			name:     "all",
+			names:    []string{"all"},
+			input:    "a\n  b\nCaused by: c\nd",
+			expected: []string{"a\n  b\nCaused by: c", "d"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records := groupRecords(t, tc.names, tc.input)
+			if strings.Join(records, "|") != strings.Join(tc.expected, "|") {
+				t.Errorf("got %q, want %q", records, tc.expected)
+			}
+		})
+	}
+}
+
+func Test_recordGrouper_matched(t *testing.T) {
+	g := recordGrouper{recognizers: []recordRecognizer{indentRecognizer{}}}
+	var b bytes.Buffer
+	fn := func(line []byte, info lineInfo, matched bool) {
+		if matched {
+			b.Write(line)
+		}
+	}
+	for _, line := range [...]struct {
+		text    string
+		matched bool
+	}{{"a", false}, {" b", true}, {"c", false}, {" d", false}, {"e", true}} {
+		if g.starts([]byte(line.text)) {
+			g.flush(fn)
+		}
+		g.add([]byte(line.text), lineInfo{}, line.matched)
+	}
+	g.flush(fn)
+	if b.String() != "a be" {
+		t.Errorf("got %q, want %q", b.String(), "a be")
+	}
+}
+
+func Test_newRecordRecognizers(t *testing.T) {
+	recognizers, err := newRecordRecognizers([]string{"go", "all", "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recognizers) != len(recordRecognizerNames) {
+		t.Errorf("got %d recognizers, want %d", len(recognizers), len(recordRecognizerNames))
+	}
+	if _, err := newRecordRecognizers([]string{"ruby"}); err == nil || !strings.Contains(err.Error(), `unknown multiline recognizer "ruby"`) {
+		t.Errorf("error = %v", err)
+	}
+}
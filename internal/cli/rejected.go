@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// inheritedFiles retains the files for inherited file descriptors, as they
+// must not be closed, including by finalizers, e.g. in case of stderr.
+var inheritedFiles struct {
+	mu    sync.Mutex
+	files map[int]*os.File
+}
+
+// openRejected opens the destination for rejected lines (--rejected, or
+// --rejected-fd), returning nil if there is none. Files opened by path must
+// be closed by the caller, while inherited file descriptors are left open.
+func (x *CLI) openRejected() (*os.File, error) {
+	switch {
+	case x.rejectedPath != ``:
+		return os.Create(x.rejectedPath)
+
+	case x.rejectedFD > 0:
+		return inheritedFile(x.rejectedFD)
+	}
+	return nil, nil
+}
+
+// inheritedFile returns a file for the inherited file descriptor fd, which
+// must not be closed.
+func inheritedFile(fd int) (*os.File, error) {
+	inheritedFiles.mu.Lock()
+	defer inheritedFiles.mu.Unlock()
+	file := inheritedFiles.files[fd]
+	if file == nil {
+		file = os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+		if file == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		if inheritedFiles.files == nil {
+			inheritedFiles.files = make(map[int]*os.File)
+		}
+		inheritedFiles.files[fd] = file
+	}
+	if _, err := file.Stat(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
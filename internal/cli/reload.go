@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// fileStamp identifies a version of a file, for the purposes of polling for
+// changes. The zero value represents a file that could not be stat'd.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	ok      bool
+}
+
+// patternSnapshot identifies a version of the set of pattern files, after
+// expanding directories and globs.
+type patternSnapshot struct {
+	stamps map[string]fileStamp
+	err    string // failed to resolve the pattern files
+}
+
+// patternWatcher polls the pattern files, recompiling all patterns and
+// swapping the active matcher whenever any of them change, or are added or
+// removed (e.g. from a pattern directory). The stderr pattern files (see
+// --stderr-pattern-file) are watched likewise, if there are any. It must only
+// be used from one goroutine, though the matchers it stores may be loaded
+// from any.
+type patternWatcher struct {
+	warn    io.Writer
+	targets []*watchedPatterns
+}
+
+// watchedPatterns is a set of pattern files, watched by patternWatcher, for
+// either stdout or stderr.
+type watchedPatterns struct {
+	name     string // for messages, e.g. "stderr patterns"
+	files    []string
+	compile  func() (*matcher, error)
+	active   *atomic.Pointer[matcher]
+	snapshot patternSnapshot
+}
+
+// newPatternWatcher returns a patternWatcher for the pattern files, storing
+// their matcher in active, and, if stderr is set, likewise for the stderr
+// pattern files.
+func newPatternWatcher(cli *CLI, active, stderr *atomic.Pointer[matcher], warn io.Writer) *patternWatcher {
+	w := &patternWatcher{warn: warn}
+	if len(cli.patternFiles) != 0 {
+		w.add("patterns", cli.patternFiles, cli.compilePatterns, active)
+	}
+	if stderr != nil && len(cli.stderrPatternFiles) != 0 {
+		w.add("stderr patterns", cli.stderrPatternFiles, cli.compileStderrPatterns, stderr)
+	}
+	return w
+}
+
+func (w *patternWatcher) add(name string, files []string, compile func() (*matcher, error), active *atomic.Pointer[matcher]) {
+	w.targets = append(w.targets, &watchedPatterns{
+		name:     name,
+		files:    files,
+		compile:  compile,
+		active:   active,
+		snapshot: snapshotPatternFiles(files),
+	})
+}
+
+// snapshotPatternFiles returns the current version of the given pattern
+// files, which may include directories and globs.
+func snapshotPatternFiles(files []string) (snapshot patternSnapshot) {
+	filePaths, err := expandPatternFiles(files)
+	if err != nil {
+		snapshot.err = err.Error()
+	}
+	snapshot.stamps = make(map[string]fileStamp, len(filePaths))
+	for _, filePath := range filePaths {
+		snapshot.stamps[filePath] = statFile(filePath)
+	}
+	return snapshot
+}
+
+func statFile(filePath string) fileStamp {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), ok: true}
+}
+
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.ok == o.ok && s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+func (s patternSnapshot) equal(o patternSnapshot) bool {
+	return s.err == o.err && maps.EqualFunc(s.stamps, o.stamps, fileStamp.equal)
+}
+
+// check reloads the patterns if any pattern file changed since the last
+// check, returning true if an active matcher was replaced. If the patterns
+// fail to load, the previous matcher is kept, and a warning is written.
+func (w *patternWatcher) check() bool {
+	var reloaded bool
+	for _, t := range w.targets {
+		if w.checkPatterns(t) {
+			reloaded = true
+		}
+	}
+	return reloaded
+}
+
+func (w *patternWatcher) checkPatterns(t *watchedPatterns) bool {
+	snapshot := snapshotPatternFiles(t.files)
+	if snapshot.equal(t.snapshot) {
+		return false
+	}
+	t.snapshot = snapshot
+
+	m, err := t.compile()
+	if err != nil {
+		_, _ = fmt.Fprintf(w.warn, "Warning: failed to reload %s (keeping previous patterns): %s\n", t.name, err)
+		return false
+	}
+
+	t.active.Store(m)
+	return true
+}
+
+// watch calls check every interval, until ctx is canceled.
+func (w *patternWatcher) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
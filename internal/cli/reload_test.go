@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_patternWatcher_check(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	patternFile := filepath.Join(tmpDir, "patterns.txt")
+	if err := os.WriteFile(patternFile, []byte("hello*\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+
+	cli := &CLI{
+		rawPatterns:  []string{"raw"},
+		patternFiles: []string{patternFile},
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+
+	var active atomic.Pointer[matcher]
+	initial := &matcher{patterns: cli.compiledPatterns}
+	active.Store(initial)
+
+	var warn bytes.Buffer
+	watcher := newPatternWatcher(cli, &active, nil, &warn)
+
+	if watcher.check() {
+		t.Fatal("expected no reload when the file is unchanged")
+	}
+
+	// modify the file, bumping the mod time to avoid relying on its resolution
+	if err := os.WriteFile(patternFile, []byte("world*\nfoo\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(patternFile, future, future); err != nil {
+		t.Fatalf("Failed to change times: %v", err)
+	}
+
+	if !watcher.check() {
+		t.Fatal("expected a reload after the file changed")
+	}
+	reloaded := active.Load()
+	if len(reloaded.patterns) != 3 {
+		t.Fatalf("expected 3 patterns after reload, got %d", len(reloaded.patterns))
+	}
+	if reloaded.match([]byte("raw")) != 0 || reloaded.match([]byte("world!")) != 1 || reloaded.match([]byte("hello")) != -1 {
+		t.Errorf("unexpected matching behavior after reload")
+	}
+
+	if watcher.check() {
+		t.Fatal("expected no reload when the file is unchanged since the last reload")
+	}
+
+	// a file that fails to load keeps the previous patterns
+	if err := os.Remove(patternFile); err != nil {
+		t.Fatalf("Failed to remove pattern file: %v", err)
+	}
+	if watcher.check() {
+		t.Fatal("expected no reload when the file fails to load")
+	}
+	if active.Load() != reloaded {
+		t.Error("expected the previous matcher to be kept")
+	}
+	if !strings.Contains(warn.String(), "Warning: failed to reload patterns") || !strings.Contains(warn.String(), patternFile) {
+		t.Errorf("expected a warning naming the file, got %q", warn.String())
+	}
+
+	// the warning isn't repeated while the file remains broken
+	warn.Reset()
+	if watcher.check() || warn.Len() != 0 {
+		t.Errorf("expected no further reload attempts, got warning %q", warn.String())
+	}
+
+	// and recovers once it is fixed
+	if err := os.WriteFile(patternFile, []byte("hello*\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	if !watcher.check() {
+		t.Fatal("expected a reload after the file was restored")
+	}
+	if active.Load().match([]byte("hello world")) != 1 {
+		t.Error("expected the restored patterns to be active")
+	}
+}
+
+func TestCLI_run_reloadPatternFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	patternFile := filepath.Join(tmpDir, "patterns.txt")
+	if err := os.WriteFile(patternFile, []byte("first*\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cli := &CLI{
+		Input:          strings.NewReader(""),
+		Output:         &stdout,
+		ErrOut:         &stderr,
+		command:        "bash",
+		args:           []string{"-c", `echo first; echo second; printf 'second*\n' > "$1"; sleep 0.5; echo first; echo second`, "bash", patternFile},
+		patternFiles:   []string{patternFile},
+		reloadInterval: 10 * time.Millisecond,
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+
+	if err := cli.run(); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	if got, want := stdout.String(), "first\nsecond\n"; got != want {
+		t.Errorf("stdout = %q, want %q (stderr %q)", got, want, stderr.String())
+	}
+}
+
+func TestCLI_run_reloadStderrPatternFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	patternFile := filepath.Join(tmpDir, "stderr.patterns")
+	if err := os.WriteFile(patternFile, []byte("first*\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cli := &CLI{
+		Input:              strings.NewReader(""),
+		Output:             &stdout,
+		ErrOut:             &stderr,
+		command:            "bash",
+		args:               []string{"-c", `echo first >&2; echo second >&2; printf 'second*\n' > "$1"; sleep 0.5; echo first >&2; echo second >&2`, "bash", patternFile},
+		stderrPatternFiles: []string{patternFile},
+		reloadInterval:     10 * time.Millisecond,
+	}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+
+	if err := cli.run(); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	if got, want := stderr.String(), "first\nsecond\n"; got != want {
+		t.Errorf("stderr = %q, want %q (stdout %q)", got, want, stdout.String())
+	}
+}
+
+func Test_patternWatcher_check_directory(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "10-a.patterns"), []byte("a\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+
+	cli := &CLI{patternFiles: []string{tmpDir}}
+	if err := cli.loadAndCompilePatterns(); err != nil {
+		t.Fatalf("loadAndCompilePatterns() error = %v", err)
+	}
+
+	var active atomic.Pointer[matcher]
+	active.Store(&matcher{patterns: cli.compiledPatterns})
+
+	var warn bytes.Buffer
+	watcher := newPatternWatcher(cli, &active, nil, &warn)
+
+	// files that aren't *.patterns are ignored
+	if err := os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("b\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if watcher.check() {
+		t.Fatal("expected no reload for an unrelated file")
+	}
+
+	// but new pattern files are picked up
+	if err := os.WriteFile(filepath.Join(tmpDir, "20-b.patterns"), []byte("b\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	if !watcher.check() {
+		t.Fatal("expected a reload after a pattern file was added")
+	}
+	if active.Load().match([]byte("b")) != 1 {
+		t.Error("expected the added pattern file to be active")
+	}
+
+	// as are removals
+	if err := os.Remove(filepath.Join(tmpDir, "10-a.patterns")); err != nil {
+		t.Fatalf("Failed to remove pattern file: %v", err)
+	}
+	if !watcher.check() {
+		t.Fatal("expected a reload after a pattern file was removed")
+	}
+	if m := active.Load(); m.match([]byte("a")) != -1 || m.match([]byte("b")) != 0 {
+		t.Error("expected only the remaining pattern file to be active")
+	}
+
+	if warn.Len() != 0 {
+		t.Errorf("unexpected warnings: %q", warn.String())
+	}
+}
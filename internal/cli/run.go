@@ -1,35 +1,139 @@
 package cli
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var errDueToMode = errors.New("error due to error mode")
 
+// killWaitDelay bounds how long to wait for the command's stderr to be
+// closed, after it was killed due to --max-count.
+const killWaitDelay = time.Second
+
 func (x *CLI) run() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, x.command, x.args...)
 
+	errOut := lockWriter(x.ErrOut)
+
 	cmd.Stdin = x.Input
-	cmd.Stderr = x.ErrOut
+
+	raw, err := x.openRawLog(errOut)
+	if err != nil {
+		return fmt.Errorf("failed to open raw log: %w", err)
+	}
+	if raw != nil {
+		// N.B. deferred, as the command's output is read until it exits
+		defer raw.close()
+	}
+
+	// N.B. rejected is nil, unless --rejected or --rejected-fd
+	rejectedFile, err := x.openRejected()
+	if err != nil {
+		return fmt.Errorf("failed to open rejected: %w", err)
+	}
+	var (
+		rejected       io.Writer
+		rejectedBuffer *bufferedWriter
+	)
+	if rejectedFile != nil {
+		rejected = rejectedFile
+		if !x.lineBuffered {
+			rejectedBuffer = newBufferedWriter(rejectedFile)
+			rejected = rejectedBuffer
+		}
+		defer func() {
+			if rejectedBuffer != nil {
+				_ = rejectedBuffer.Flush()
+			}
+			if x.rejectedPath != `` {
+				_ = rejectedFile.Close()
+			}
+		}()
+	}
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdout pipe for command: %w", err)
 	}
 
+	// N.B. stderr is passed through as-is, unless it is filtered (or
+	// counted), or merged with stdout
+	var stderrPipe io.ReadCloser
+	if x.stderrPiped() || x.merge {
+		stderrPipe, err = cmd.StderrPipe()
+		if err != nil {
+			return fmt.Errorf("failed to create stderr pipe for command: %w", err)
+		}
+	} else {
+		cmd.Stderr = errOut
+	}
+
+	// N.B. elapsed timestamps are relative to (just prior to) starting
+	prefixer := x.newLinePrefixer(time.Now())
+
+	var active, stderrActive atomic.Pointer[matcher]
+	active.Store(x.newMatcher())
+	stderrActive.Store(x.newStderrMatcher())
+
+	// N.B. must be initialized prior to starting the command, to avoid
+	// missing any changes
+	var watcher *patternWatcher
+	if x.reloadInterval > 0 && (len(x.patternFiles) != 0 || len(x.stderrPatternFiles) != 0) {
+		watcher = newPatternWatcher(x, &active, &stderrActive, errOut)
+	}
+
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start command %q: %w", x.command, err)
 	}
 
+	// N.B. stderr must be read in full prior to cmd.Wait, see waitStderr
+	var (
+		stderrDone    chan struct{}
+		stderrContent bool
+	)
+	if stderrPipe != nil && !x.merge {
+		stderrDone = make(chan struct{})
+		go func() {
+			defer close(stderrDone)
+			stderrContent = x.filterStderr(stderrPipe, errOut, &stderrActive)
+		}()
+	}
+	// waitStderr waits until stderr has been filtered, or, if delay is
+	// positive, at most that long, e.g. if the command was killed, as any
+	// orphaned descendants may hold stderr open
+	waitStderr := func(delay time.Duration) {
+		if stderrDone == nil {
+			return
+		}
+		if delay > 0 {
+			select {
+			case <-stderrDone:
+				return
+			case <-time.After(delay):
+			}
+			_ = stderrPipe.Close()
+		}
+		<-stderrDone
+	}
+	// checkContent applies the error mode, which may consider stderr
+	checkContent := func(content bool) error {
+		return x.checkContent(content || (x.errorModeStderr && stderrContent))
+	}
+
+	// N.B. all signals (including SIGHUP) are forwarded, pattern files are
+	// only reloaded by polling
 	if proc := cmd.Process; proc == nil {
 		panic("cmd.Process is nil after cmd.Start()")
 	} else {
@@ -46,42 +150,178 @@ func (x *CLI) run() error {
 		}()
 	}
 
-	var content bool
+	if watcher != nil {
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watcher.watch(watchCtx, x.reloadInterval)
+		}()
+		defer func() {
+			stopWatching()
+			wg.Wait()
+		}()
+	}
+
+	var (
+		content bool
+		killed  bool // killed due to --max-count
+	)
 
 	{
-		scanner := bufio.NewScanner(stdoutPipe)
+		// N.B. everything read from the command is also written to the
+		// raw log, including anything discarded
+		var stdout io.Reader = stdoutPipe
+		if raw != nil {
+			stdout = io.TeeReader(stdoutPipe, raw)
+		}
 
-		for scanner.Scan() {
-			line := scanner.Text()
+		newReader := func(r io.Reader) *lineReader {
+			reader := newLineReader(r, x.maxLineLength)
+			reader.crSegments = x.crSegments
+			reader.separator = x.separator
+			reader.separatorRegex = x.separatorRegex
+			return reader
+		}
+		reader := newReader(stdout)
+		reader.pipe, _ = stdoutPipe.(readDeadliner)
+
+		// N.B. stderr is read like stdout, with --merge
+		var stderrReader *lineReader
+		if x.merge {
+			stderrReader = newReader(stderrPipe)
+		}
 
-			var matched bool
+		// N.B. set if lines are filtered, see below
+		var source lineSource
 
-			for _, re := range x.compiledPatterns {
-				if re.MatchString(line) {
-					matched = true
+		// N.B. only the start of the output is inspected, see sniff
+		var binary bool
+		switch x.binaryPolicy {
+		case binarySkip, binaryPass, binarySummary:
+			binary = looksBinary(reader.sniff())
+		}
+
+		switch {
+		case binary && x.binaryPolicy == binaryPass:
+			n, _ := reader.copyAll(x.Output)
+			content = n != 0
+
+		case binary && x.binaryPolicy == binarySkip:
+			if rejected != nil {
+				_, _ = reader.copyAll(rejected)
+			} else {
+				_, _ = reader.copyAll(io.Discard)
+			}
+
+		default:
+			// N.B. output is buffered, unless --line-buffered, and flushed
+			// prior to waiting for more input, see below
+			var (
+				buffered *bufferedWriter
+				output   = x.Output
+			)
+			if !x.lineBuffered {
+				buffered = newBufferedWriter(x.Output)
+				output = buffered
+			}
+
+			f := x.newLineFilter(output, errOut, rejected, prefixer, binary)
+
+			// N.B. truncated lines are rejected in full, unless they're part
+			// of a multi-line record, which would require buffering them
+			var (
+				timestamps = prefixer != nil && prefixer.timestamp != ``
+				rejectRest = rejected != nil && f.records == nil
+			)
+			if stderrReader != nil {
+				source = x.newMergedSource(reader, stderrReader, &active, timestamps, rejectRest)
+			} else {
+				source = x.newLineSource(reader, &active, timestamps, rejectRest)
+			}
+			for {
+				// N.B. checked prior to reading more, so the command is
+				// killed as soon as the limit is reached
+				if f.limited() {
+					if x.maxCountAction == maxCountKill {
+						killed = true
+						break
+					}
+					// N.B. the rest of the input is rejected, in order
+					f.drain(source)
 					break
 				}
-			}
 
-			if x.invertMatch != matched {
-				_, _ = fmt.Fprintln(x.Output, line)
-				if !content {
-					content = true
+				// N.B. a record only ends when the next starts, so it's
+				// written if the command is idle, rather than held back
+				if f.records != nil && f.records.n != 0 && source.idle() && !source.wait(recordIdleDelay) {
+					f.flushRecord()
+				}
+
+				if (buffered != nil || rejectedBuffer != nil) && source.idle() {
+					// N.B. the command may be idle, and we may block
+					if buffered != nil {
+						_ = buffered.Flush()
+					}
+					if rejectedBuffer != nil {
+						_ = rejectedBuffer.Flush()
+					}
+				}
+				l, ok := source.next()
+				if !ok {
+					break
 				}
+				f.line(l)
+			}
+
+			f.finish()
+			content = f.content
+			if buffered != nil {
+				_ = buffered.Flush()
+			}
+		}
+
+		if killed {
+			// N.B. the exit status of the command is irrelevant, and any
+			// orphaned descendants may hold stderr open, so don't wait long
+			_ = cmd.Process.Kill()
+			_ = stdoutPipe.Close()
+			if stderrReader != nil {
+				_ = stderrPipe.Close()
 			}
+			source.close()
+			waitStderr(killWaitDelay)
+			cmd.WaitDelay = killWaitDelay
+			_ = cmd.Wait()
+			return checkContent(content)
+		}
+
+		if source != nil {
+			source.close()
 		}
 
-		err = scanner.Err()
+		err := reader.Err()
+		if err == nil && stderrReader != nil {
+			err = stderrReader.Err()
+		}
 		if err != nil {
+			// N.B. the command must still be reaped
+			cancel()
+			waitStderr(killWaitDelay)
+			_ = cmd.Wait()
 			return err
 		}
 	}
 
 	err = stdoutPipe.Close()
 	if err != nil {
+		waitStderr(killWaitDelay)
 		return err
 	}
 
+	waitStderr(0)
+
 	err = cmd.Wait()
 	if err != nil {
 		return err
@@ -92,6 +332,12 @@ func (x *CLI) run() error {
 		return err
 	}
 
+	return checkContent(content)
+}
+
+// checkContent applies the error mode, given whether there was content,
+// after the command succeeded.
+func (x *CLI) checkContent(content bool) error {
 	switch x.errorMode {
 	case errorModeOnContent:
 		if content {
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -391,3 +395,1517 @@ func TestCLI_run_errorModes(t *testing.T) {
 		})
 	}
 }
+
+func TestCLI_run_longLines(t *testing.T) {
+	long := strings.Repeat("0", 100000)
+
+	tests := []struct {
+		name           string
+		maxLineLength  int
+		policy         longLinePolicy
+		invertMatch    bool
+		expectedOutput string
+		expectedStderr string
+	}{
+		{
+			name:           "unlimited",
+			invertMatch:    true,
+			expectedOutput: "short\n" + long + "\nend\n",
+		},
+		{
+			name:           "unlimited matching",
+			expectedOutput: long + "\n",
+		},
+		{
+			name:           "truncate",
+			maxLineLength:  10,
+			policy:         longLineTruncate,
+			invertMatch:    true,
+			expectedOutput: "short\n0000000000\nend\n",
+		},
+		{
+			name:           "truncate matching",
+			maxLineLength:  10,
+			policy:         longLineTruncate,
+			expectedOutput: "0000000000\n",
+		},
+		{
+			name:           "pass",
+			maxLineLength:  10,
+			policy:         longLinePass,
+			expectedOutput: long + "\n",
+		},
+		{
+			name:           "drop",
+			maxLineLength:  10,
+			policy:         longLineDrop,
+			invertMatch:    true,
+			expectedOutput: "short\nend\n",
+			expectedStderr: "Warning: dropped line 2 (100000 bytes), exceeding --max-line-length\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := &CLI{
+				Input:          strings.NewReader(""),
+				Output:         &stdout,
+				ErrOut:         &stderr,
+				command:        "bash",
+				args:           []string{"-c", `echo short; printf '%0100000d\n' 0; echo end`},
+				invertMatch:    tc.invertMatch,
+				maxLineLength:  tc.maxLineLength,
+				longLinePolicy: tc.policy,
+			}
+			if !tc.invertMatch {
+				cli.compiledPatterns = []*regexp.Regexp{compileSinglePattern("0*")}
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %.50q (len %d), want %.50q (len %d)", got, len(got), tc.expectedOutput, len(tc.expectedOutput))
+			}
+			if got := stderr.String(); got != tc.expectedStderr {
+				t.Errorf("stderr = %q, want %q", got, tc.expectedStderr)
+			}
+		})
+	}
+}
+
+func TestCLI_run_byteExact(t *testing.T) {
+	tests := []struct {
+		name           string
+		script         string
+		maxLineLength  int
+		policy         longLinePolicy
+		expectedOutput string
+	}{
+		{
+			name:           "crlf preserved",
+			script:         `printf 'keep 1\r\ndrop\r\nkeep 2\r\n'`,
+			expectedOutput: "keep 1\r\nkeep 2\r\n",
+		},
+		{
+			name:           "missing final newline preserved",
+			script:         `printf 'keep 1\nkeep 2'`,
+			expectedOutput: "keep 1\nkeep 2",
+		},
+		{
+			name:           "missing final newline after carriage return",
+			script:         `printf 'keep 1\r\nkeep 2\r'`,
+			expectedOutput: "keep 1\r\nkeep 2\r",
+		},
+		{
+			name:           "invalid utf-8 preserved",
+			script:         `printf 'keep \xff\xfe\n'`,
+			expectedOutput: "keep \xff\xfe\n",
+		},
+		{
+			name:           "truncated keeps terminator",
+			script:         `printf 'keep 1 and more\r\nkeep 2 and more'`,
+			maxLineLength:  6,
+			policy:         longLineTruncate,
+			expectedOutput: "keep 1\r\nkeep 2",
+		},
+		{
+			name:           "passed keeps terminator",
+			script:         `printf 'keep 1 and more\r\nkeep 2 and more'`,
+			maxLineLength:  6,
+			policy:         longLinePass,
+			expectedOutput: "keep 1 and more\r\nkeep 2 and more",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := &CLI{
+				Input:            strings.NewReader(""),
+				Output:           &stdout,
+				ErrOut:           &stderr,
+				command:          "bash",
+				args:             []string{"-c", tc.script},
+				compiledPatterns: []*regexp.Regexp{compileSinglePattern("keep*")},
+				maxLineLength:    tc.maxLineLength,
+				longLinePolicy:   tc.policy,
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_crSegments(t *testing.T) {
+	tests := []struct {
+		name           string
+		crSegments     bool
+		patterns       []string
+		invertMatch    bool
+		lineNumbers    bool
+		workers        int
+		expectedOutput string
+	}{
+		{
+			name:           "disabled",
+			patterns:       []string{"10%"},
+			expectedOutput: "",
+		},
+		{
+			name:           "disabled matches whole line",
+			patterns:       []string{"downloading*"},
+			expectedOutput: "downloading\r10%\r50%\r100%\n",
+		},
+		{
+			name:           "keep progress",
+			crSegments:     true,
+			patterns:       []string{"*%", "done"},
+			expectedOutput: "10%\r50%\r100%\ndone\r\n",
+		},
+		{
+			name:           "suppress progress",
+			crSegments:     true,
+			patterns:       []string{"*%"},
+			invertMatch:    true,
+			expectedOutput: "downloading\rdone\r\n",
+		},
+		{
+			name:           "line numbers",
+			crSegments:     true,
+			patterns:       []string{"*%", "done"},
+			lineNumbers:    true,
+			expectedOutput: "1:10%\r1:50%\r1:100%\n2:done\r\n",
+		},
+		{
+			name:           "line numbers parallel",
+			crSegments:     true,
+			patterns:       []string{"*%", "done"},
+			lineNumbers:    true,
+			workers:        2,
+			expectedOutput: "1:10%\r1:50%\r1:100%\n2:done\r\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := &CLI{
+				Input:       strings.NewReader(""),
+				Output:      &stdout,
+				ErrOut:      &stderr,
+				command:     "bash",
+				args:        []string{"-c", `printf 'downloading\r10%%\r50%%\r100%%\ndone\r\n'`},
+				invertMatch: tc.invertMatch,
+				crSegments:  tc.crSegments,
+				lineNumbers: tc.lineNumbers,
+				workers:     tc.workers,
+			}
+			for _, p := range tc.patterns {
+				cli.compiledPatterns = append(cli.compiledPatterns, compileSinglePattern(p))
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_recordSeparator(t *testing.T) {
+	tests := []struct {
+		name           string
+		separator      string
+		regex          string
+		patterns       []string
+		invertMatch    bool
+		expectedOutput string
+	}{
+		{
+			name:           "lines",
+			patterns:       []string{"*.go"},
+			expectedOutput: "",
+		},
+		{
+			name:           "nul",
+			separator:      "\x00",
+			patterns:       []string{"*.go"},
+			expectedOutput: "a.go\x00new\nline.go\x00",
+		},
+		{
+			name:           "nul inverted",
+			separator:      "\x00",
+			patterns:       []string{"*.go"},
+			invertMatch:    true,
+			expectedOutput: "b.txt\x00c.txt",
+		},
+		{
+			name:           "regex",
+			regex:          `\x00|\n`,
+			patterns:       []string{"*.go"},
+			expectedOutput: "a.go\x00line.go\x00",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := &CLI{
+				Input:       strings.NewReader(""),
+				Output:      &stdout,
+				ErrOut:      &stderr,
+				command:     "bash",
+				args:        []string{"-c", `printf 'a.go\0b.txt\0new\nline.go\0c.txt'`},
+				invertMatch: tc.invertMatch,
+			}
+			if tc.separator != "" {
+				cli.separator = []byte(tc.separator)
+			}
+			if tc.regex != "" {
+				cli.separatorRegex = regexp.MustCompile(tc.regex)
+			}
+			for _, p := range tc.patterns {
+				cli.compiledPatterns = append(cli.compiledPatterns, compileSinglePattern(p))
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_context(t *testing.T) {
+	tests := []struct {
+		name           string
+		cli            CLI
+		patterns       []string
+		expectedOutput string
+		expectedErr    error
+	}{
+		{
+			name:           "after",
+			cli:            CLI{afterContext: 1, groupSeparator: "--"},
+			patterns:       []string{"error*"},
+			expectedOutput: "error 1\nb\n--\nerror 2\r\nd",
+		},
+		{
+			name:           "before",
+			cli:            CLI{beforeContext: 2, groupSeparator: "--"},
+			patterns:       []string{"error*"},
+			expectedOutput: "a\nerror 1\nb\nc\nerror 2\r\n",
+		},
+		{
+			name:           "no separator",
+			cli:            CLI{afterContext: 1, groupSeparator: "--", noGroupSeparator: true},
+			patterns:       []string{"error*"},
+			expectedOutput: "error 1\nb\nerror 2\r\nd",
+		},
+		{
+			name:           "on content",
+			cli:            CLI{aroundContext: 1, groupSeparator: "--", errorMode: errorModeOnContent},
+			patterns:       []string{"error 2"},
+			expectedOutput: "c\nerror 2\r\nd",
+			expectedErr:    errDueToMode,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "bash"
+			cli.args = []string{"-c", `printf 'a\nerror 1\nb\nc\nerror 2\r\nd'`}
+			for _, p := range tc.patterns {
+				cli.compiledPatterns = append(cli.compiledPatterns, compileSinglePattern(p))
+			}
+
+			if err := cli.run(); !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("run() error = %v, want %v", err, tc.expectedErr)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_multiline(t *testing.T) {
+	tests := []struct {
+		name           string
+		multiline      []string
+		patterns       []string
+		invertMatch    bool
+		expectedOutput string
+	}{
+		{
+			name:           "disabled",
+			patterns:       []string{"panic: *"},
+			expectedOutput: "panic: boom\n",
+		},
+		{
+			name:           "keep record",
+			multiline:      []string{"go"},
+			patterns:       []string{"panic: *"},
+			expectedOutput: "panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/tmp/main.go:4 +0x25\n",
+		},
+		{
+			name:           "suppress record",
+			multiline:      []string{"all"},
+			patterns:       []string{"panic: *"},
+			invertMatch:    true,
+			expectedOutput: "ok\nexit status 2",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := &CLI{
+				Input:       strings.NewReader(""),
+				Output:      &stdout,
+				ErrOut:      &stderr,
+				command:     "bash",
+				args:        []string{"-c", `printf 'ok\npanic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/tmp/main.go:4 +0x25\nexit status 2'`},
+				invertMatch: tc.invertMatch,
+				multiline:   tc.multiline,
+			}
+			for _, p := range tc.patterns {
+				cli.compiledPatterns = append(cli.compiledPatterns, compileSinglePattern(p))
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_maxCount(t *testing.T) {
+	tests := []struct {
+		name           string
+		cli            CLI
+		script         string
+		expectedOutput string
+		expectedCode   int // -1 for a nil error
+		expectedErr    error
+	}{
+		{
+			name:           "unlimited",
+			cli:            CLI{maxCountAction: maxCountDrain},
+			script:         `printf 'a1\nb\na2\na3\n'; exit 3`,
+			expectedOutput: "a1\na2\na3\n",
+			expectedCode:   3,
+		},
+		{
+			name:           "drain",
+			cli:            CLI{maxCount: 2, maxCountAction: maxCountDrain},
+			script:         `printf 'a1\nb\na2\na3\n'; exit 3`,
+			expectedOutput: "a1\na2\n",
+			expectedCode:   3,
+		},
+		{
+			name:           "drain zero value",
+			cli:            CLI{maxCount: 1},
+			script:         `printf 'a1\nb\na2\na3\n'`,
+			expectedOutput: "a1\n",
+			expectedCode:   -1,
+		},
+		{
+			name:           "kill",
+			cli:            CLI{maxCount: 2, maxCountAction: maxCountKill},
+			script:         `printf 'a1\nb\na2\na3\n'; sleep 10; exit 3`,
+			expectedOutput: "a1\na2\n",
+			expectedCode:   -1,
+		},
+		{
+			name:           "kill on content",
+			cli:            CLI{maxCount: 1, maxCountAction: maxCountKill, errorMode: errorModeOnContent},
+			script:         `printf 'a1\nb\na2\na3\n'; sleep 10; exit 3`,
+			expectedOutput: "a1\n",
+			expectedErr:    errDueToMode,
+		},
+		{
+			name:           "kill once reached",
+			cli:            CLI{maxCount: 1, maxCountAction: maxCountKill},
+			script:         `echo a1; sleep 10; echo a2`,
+			expectedOutput: "a1\n",
+			expectedCode:   -1,
+		},
+		{
+			name:           "kill once record reached",
+			cli:            CLI{maxCount: 1, maxCountAction: maxCountKill, multiline: []string{"indent"}},
+			script:         `printf 'a1\n x\nb\n'; sleep 10; echo a2`,
+			expectedOutput: "a1\n x\n",
+			expectedCode:   -1,
+		},
+		{
+			name:           "kill not reached",
+			cli:            CLI{maxCount: 5, maxCountAction: maxCountKill},
+			script:         `printf 'a1\nb\na2\na3\n'; exit 3`,
+			expectedOutput: "a1\na2\na3\n",
+			expectedCode:   3,
+		},
+		{
+			name:           "records",
+			cli:            CLI{maxCount: 2, multiline: []string{"indent"}},
+			script:         `printf 'a1\n x\n y\nb\na2\n z\na3\n'`,
+			expectedOutput: "a1\n x\n y\na2\n z\n",
+			expectedCode:   -1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "bash"
+			cli.args = []string{"-c", tc.script}
+			cli.compiledPatterns = []*regexp.Regexp{compileSinglePattern("a*")}
+
+			start := time.Now()
+			err := cli.run()
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("run() took %s", elapsed)
+			}
+
+			switch {
+			case tc.expectedErr != nil:
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("run() error = %v, want %v", err, tc.expectedErr)
+				}
+			case tc.expectedCode == -1:
+				if err != nil {
+					t.Errorf("run() error = %v", err)
+				}
+			default:
+				var exitErr *exec.ExitError
+				if !errors.As(err, &exitErr) || exitErr.ExitCode() != tc.expectedCode {
+					t.Errorf("run() error = %v, want exit code %d", err, tc.expectedCode)
+				}
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_lineNumbers(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	cli := &CLI{
+		Input:          strings.NewReader(""),
+		Output:         &stdout,
+		ErrOut:         &stderr,
+		command:        "bash",
+		args:           []string{"-c", `printf 'a\nerror 1\nb\nc\nerror 2\r\nd\n'`},
+		lineNumbers:    true,
+		beforeContext:  1,
+		groupSeparator: "--",
+	}
+	cli.compiledPatterns = []*regexp.Regexp{compileSinglePattern("error*")}
+
+	if err := cli.run(); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	if expected := "1-a\n2:error 1\n--\n4-c\n5:error 2\r\n"; stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q (stderr %q)", stdout.String(), expected, stderr.String())
+	}
+}
+
+func TestCLI_run_timestamp(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	cli := &CLI{
+		Input:     strings.NewReader(""),
+		Output:    &stdout,
+		ErrOut:    &stderr,
+		command:   "bash",
+		args:      []string{"-c", `echo a; sleep 0.3; echo b`},
+		timestamp: timestampElapsed,
+	}
+	cli.compiledPatterns = []*regexp.Regexp{compileSinglePattern("*")}
+
+	if err := cli.run(); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	// N.B. the time is when each line was read, not when it was written
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected output %q", stdout.String())
+	}
+	var elapsed [2]float64
+	for i, line := range lines {
+		if _, err := fmt.Sscanf(line, "[%f]", &elapsed[i]); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+	}
+	if d := elapsed[1] - elapsed[0]; d < 0.25 || d > 2 {
+		t.Errorf("unexpected elapsed times %v", elapsed)
+	}
+}
+
+func TestCLI_run_collapseRepeats(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	cli := &CLI{
+		Input:           strings.NewReader(""),
+		Output:          &stdout,
+		ErrOut:          &stderr,
+		command:         "bash",
+		args:            []string{"-c", `for i in 1 2 3; do echo "retry $i: refused"; echo noise; done; echo done; echo "retry 4: refused"`},
+		collapseRepeats: true,
+	}
+	cli.collapseNormalize = []string{`\d+`}
+	if err := cli.compileCollapseNormalize(); err != nil {
+		t.Fatal(err)
+	}
+	cli.compiledPatterns = []*regexp.Regexp{compileSinglePattern("retry*"), compileSinglePattern("done")}
+
+	if err := cli.run(); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	if expected := "retry 1: refused\nlast line repeated 2 times\ndone\nretry 4: refused\n"; stdout.String() != expected {
+		t.Errorf("stdout = %q, want %q (stderr %q)", stdout.String(), expected, stderr.String())
+	}
+}
+
+func TestCLI_run_perPatternLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		cli            CLI
+		expectedOutput string
+	}{
+		{
+			name:           "unlimited",
+			expectedOutput: "warn 1\nerror 1\nwarn 2\nwarn 3\nerror 2\nwarn 4\n",
+		},
+		{
+			name:           "global",
+			cli:            CLI{perPatternLimit: 2},
+			expectedOutput: "warn 1\nerror 1\nwarn 2\nerror 2\npattern \"warn*\" suppressed 2 more lines\n",
+		},
+		{
+			name:           "records",
+			cli:            CLI{perPatternLimit: 1, multiline: []string{"indent"}},
+			expectedOutput: "warn 1\n  detail\nerror 1\npattern \"warn*\" suppressed 4 more lines\npattern \"error*\" suppressed 1 more line\n",
+		},
+		{
+			name:           "inverted",
+			cli:            CLI{perPatternLimit: 1, invertMatch: true},
+			expectedOutput: "  detail\n  detail\nnoise\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "bash"
+			cli.args = []string{"-c", `printf 'warn 1\n  detail\nerror 1\nwarn 2\nwarn 3\n  detail\nnoise\nerror 2\nwarn 4\n'`}
+			cli.rawPatterns = []string{"warn*", "error*"}
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_rateLimit(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	cli := CLI{
+		Input:       strings.NewReader(""),
+		Output:      &stdout,
+		ErrOut:      &stderr,
+		command:     "seq",
+		args:        []string{"1", "100"},
+		invertMatch: true,
+		lineNumbers: true,
+		rateLimit:   rateLimit{lines: 5, per: time.Hour},
+	}
+
+	if err := cli.run(); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	var expected strings.Builder
+	for i := 1; i <= 100; i++ {
+		if i <= 5 || i > 90 {
+			fmt.Fprintf(&expected, "%d:%d\n", i, i)
+		}
+	}
+	if got := stdout.String(); got != expected.String() {
+		t.Errorf("stdout = %q, want %q", got, expected.String())
+	}
+	if expected := "Warning: --rate-limit dropped 85 lines in total\n"; stderr.String() != expected {
+		t.Errorf("stderr = %q, want %q", stderr.String(), expected)
+	}
+}
+
+func TestCLI_run_lineBuffered(t *testing.T) {
+	for _, lineBuffered := range []bool{false, true} {
+		t.Run(fmt.Sprint(lineBuffered), func(t *testing.T) {
+			var stdout bytes.Buffer
+			output := &lockedWriter{w: &stdout}
+			read := func() string {
+				output.mu.Lock()
+				defer output.mu.Unlock()
+				return stdout.String()
+			}
+
+			cli := CLI{
+				Input:        strings.NewReader(""),
+				Output:       output,
+				ErrOut:       &bytes.Buffer{},
+				command:      "bash",
+				args:         []string{"-c", `printf 'a\nb'; sleep 1; printf '\nc\n'`},
+				invertMatch:  true,
+				lineBuffered: lineBuffered,
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- cli.run() }()
+
+			// N.B. the command is idle, part way through a line
+			time.Sleep(500 * time.Millisecond)
+			if got := read(); got != "a\n" {
+				t.Errorf("stdout while idle = %q, want %q", got, "a\n")
+			}
+
+			if err := <-done; err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if got := read(); got != "a\nb\nc\n" {
+				t.Errorf("stdout = %q", got)
+			}
+		})
+	}
+}
+
+func TestCLI_run_exclude(t *testing.T) {
+	const input = "make[1]: Entering directory '/src'\ncc -o foo foo.c\nerror: bad\nmake: 'foo' is up to date.\n"
+
+	for _, tc := range []struct {
+		name     string
+		cli      CLI
+		expected string
+	}{
+		{name: "alone", cli: CLI{presets: []string{"make-noise"}}, expected: "cc -o foo foo.c\nerror: bad\n"},
+		{name: "inverted", cli: CLI{presets: []string{"make-noise"}, invertMatch: true}, expected: "cc -o foo foo.c\nerror: bad\n"},
+		{name: "with patterns", cli: CLI{presets: []string{"make-noise"}, rawPatterns: []string{"error: *", "make*"}}, expected: "error: bad\n"},
+		{name: "with inverted patterns", cli: CLI{presets: []string{"make-noise"}, rawPatterns: []string{"cc *"}, invertMatch: true}, expected: "error: bad\n"},
+		{name: "records", cli: CLI{presets: []string{"make-noise"}, multiline: []string{"indent"}}, expected: "cc -o foo foo.c\nerror: bad\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "printf"
+			cli.args = []string{"%s", input}
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if got := stdout.String(); got != tc.expected {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expected, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_run_multilineIdle(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		workers int
+		merge   bool
+	}{
+		{name: "serial", workers: 1},
+		{name: "parallel", workers: 3},
+		{name: "merge", merge: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			output := &lockedWriter{w: &stdout}
+			read := func() string {
+				output.mu.Lock()
+				defer output.mu.Unlock()
+				return stdout.String()
+			}
+
+			cli := CLI{
+				Input:       strings.NewReader(""),
+				Output:      output,
+				ErrOut:      &bytes.Buffer{},
+				command:     "bash",
+				args:        []string{"-c", `echo ERROR boom; echo '  at x'; sleep 1; echo done`},
+				rawPatterns: []string{"ERROR*"},
+				multiline:   []string{"indent"},
+				workers:     tc.workers,
+				merge:       tc.merge,
+			}
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- cli.run() }()
+
+			// N.B. the record is written once the command is idle
+			time.Sleep(500 * time.Millisecond)
+			if got := read(); got != "ERROR boom\n  at x\n" {
+				t.Errorf("stdout while idle = %q, want %q", got, "ERROR boom\n  at x\n")
+			}
+
+			if err := <-done; err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if got := read(); got != "ERROR boom\n  at x\n" {
+				t.Errorf("stdout = %q", got)
+			}
+		})
+	}
+}
+
+func TestCLI_run_workers(t *testing.T) {
+	// N.B. enough patterns to match in parallel by default
+	patterns := make([]string, 0, parallelPatternThreshold)
+	for i := range parallelPatternThreshold {
+		patterns = append(patterns, fmt.Sprintf("*%02d", i+1))
+	}
+
+	run := func(workers int) string {
+		var stdout, stderr bytes.Buffer
+		cli := CLI{
+			Input:         strings.NewReader(""),
+			Output:        &stdout,
+			ErrOut:        &stderr,
+			command:       "seq",
+			args:          []string{"1", "20000"},
+			rawPatterns:   patterns,
+			workers:       workers,
+			lineNumbers:   true,
+			beforeContext: 1,
+			maxCount:      10000,
+		}
+		if err := cli.loadAndCompilePatterns(); err != nil {
+			t.Fatal(err)
+		}
+		if err := cli.run(); err != nil {
+			t.Fatalf("run() error = %v (stderr %q)", err, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	expected := run(1)
+	if !strings.HasPrefix(expected, "9-9\n10:10\n11:11\n") {
+		t.Fatalf("unexpected output %q", expected[:min(len(expected), 100)])
+	}
+	for _, workers := range []int{0, 2, 8} {
+		if got := run(workers); got != expected {
+			t.Errorf("workers %d: output differs, got %d bytes, want %d", workers, len(got), len(expected))
+		}
+	}
+}
+
+func TestCLI_run_rawLog(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cli  CLI
+	}{
+		{name: "filtered", cli: CLI{rawPatterns: []string{"b*"}}},
+		{name: "max count", cli: CLI{rawPatterns: []string{"b*"}, maxCount: 1}},
+		{name: "binary", cli: CLI{binaryPolicy: binarySkip}},
+		{name: "parallel", cli: CLI{rawPatterns: []string{"b*"}, workers: 2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			path := t.TempDir() + "/raw.log"
+
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "bash"
+			cli.args = []string{"-c", `printf 'a\nb\r\nc\x00\nb2'`}
+			cli.rawLogPath = path
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v (stderr %q)", err, stderr.String())
+			}
+
+			if got := readRawLog(t, path, false); got != "a\nb\r\nc\x00\nb2" {
+				t.Errorf("raw log = %q", got)
+			}
+			if tc.cli.binaryPolicy == `` && !strings.HasPrefix(stdout.String(), "b\r\n") {
+				t.Errorf("stdout = %q", stdout.String())
+			}
+		})
+	}
+
+	cli := CLI{
+		Input:      strings.NewReader(""),
+		Output:     &bytes.Buffer{},
+		ErrOut:     &bytes.Buffer{},
+		command:    "true",
+		rawLogPath: t.TempDir() + "/missing/raw.log",
+	}
+	if err := cli.run(); err == nil || !strings.HasPrefix(err.Error(), "failed to open raw log: ") {
+		t.Errorf("run() error = %v", err)
+	}
+}
+
+func TestCLI_run_rejected(t *testing.T) {
+	const input = "a\nb 1\r\n  more\nc\nb 2\nlong line b\nb 3\nd"
+
+	tests := []struct {
+		name             string
+		cli              CLI
+		expectedOutput   string
+		expectedRejected string
+	}{
+		{
+			name:             "filtered",
+			cli:              CLI{rawPatterns: []string{"b*"}},
+			expectedOutput:   "b 1\r\nb 2\nb 3\n",
+			expectedRejected: "a\n  more\nc\nlong line b\nd",
+		},
+		{
+			name:             "inverted with context",
+			cli:              CLI{rawPatterns: []string{"b*"}, invertMatch: true, afterContext: 1},
+			expectedOutput:   "a\nb 1\r\n  more\nc\nb 2\nlong line b\nb 3\nd",
+			expectedRejected: "",
+		},
+		{
+			name:             "context",
+			cli:              CLI{rawPatterns: []string{"c"}, aroundContext: 1, groupSeparator: "--"},
+			expectedOutput:   "  more\nc\nb 2\n",
+			expectedRejected: "a\nb 1\r\nlong line b\nb 3\nd",
+		},
+		{
+			name:             "records and limits",
+			cli:              CLI{rawPatterns: []string{"b*"}, multiline: []string{"indent"}, perPatternLimit: 1},
+			expectedOutput:   "b 1\r\n  more\npattern \"b*\" suppressed 2 more lines\n",
+			expectedRejected: "a\nc\nb 2\nlong line b\nb 3\nd",
+		},
+		{
+			name:             "max count",
+			cli:              CLI{rawPatterns: []string{"b*"}, maxCount: 1},
+			expectedOutput:   "b 1\r\n",
+			expectedRejected: "a\n  more\nc\nb 2\nlong line b\nb 3\nd",
+		},
+		{
+			name:             "max count records",
+			cli:              CLI{rawPatterns: []string{"b*"}, maxCount: 1, multiline: []string{"indent"}, workers: 2},
+			expectedOutput:   "b 1\r\n  more\n",
+			expectedRejected: "a\nc\nb 2\nlong line b\nb 3\nd",
+		},
+		{
+			name:             "long lines dropped",
+			cli:              CLI{rawPatterns: []string{"*b*"}, maxLineLength: 6, longLinePolicy: longLineDrop},
+			expectedOutput:   "b 1\r\nb 2\nb 3\n",
+			expectedRejected: "a\n  more\nc\nlong line b\nd",
+		},
+		{
+			name:             "long lines truncated",
+			cli:              CLI{rawPatterns: []string{"b*"}, maxLineLength: 6},
+			expectedOutput:   "b 1\r\nb 2\nb 3\n",
+			expectedRejected: "a\n  more\nc\nlong line b\nd",
+		},
+		{
+			name:             "long lines truncated parallel",
+			cli:              CLI{rawPatterns: []string{"b*"}, maxLineLength: 6, workers: 3},
+			expectedOutput:   "b 1\r\nb 2\nb 3\n",
+			expectedRejected: "a\n  more\nc\nlong line b\nd",
+		},
+		{
+			name:             "long lines truncated kept",
+			cli:              CLI{rawPatterns: []string{"long*"}, maxLineLength: 6},
+			expectedOutput:   "long l\n",
+			expectedRejected: "a\nb 1\r\n  more\nc\nb 2\nb 3\nd",
+		},
+		{
+			name:             "long lines truncated context after",
+			cli:              CLI{rawPatterns: []string{"b 2"}, maxLineLength: 6, afterContext: 1, groupSeparator: "--"},
+			expectedOutput:   "b 2\nlong l\n",
+			expectedRejected: "a\nb 1\r\n  more\nc\nb 3\nd",
+		},
+		{
+			name:             "long lines truncated context before",
+			cli:              CLI{rawPatterns: []string{"b 3"}, maxLineLength: 6, beforeContext: 1, groupSeparator: "--"},
+			expectedOutput:   "b 3\n",
+			expectedRejected: "a\nb 1\r\n  more\nc\nb 2\nlong line b\nd",
+		},
+		{
+			name:             "long lines truncated records",
+			cli:              CLI{rawPatterns: []string{"b*"}, maxLineLength: 6, multiline: []string{"indent"}},
+			expectedOutput:   "b 1\r\n  more\nb 2\nb 3\n",
+			expectedRejected: "a\nc\nlong l\nd",
+		},
+		{
+			name:             "rate limited",
+			cli:              CLI{rawPatterns: []string{"b*"}, rateLimit: rateLimit{lines: 1, per: time.Hour}},
+			expectedOutput:   "b 1\r\nb 2\nb 3\n",
+			expectedRejected: "a\n  more\nc\nlong line b\nd",
+		},
+		{
+			name:             "rate limited truncated",
+			cli:              CLI{rawPatterns: []string{"b*", "long*"}, rateLimit: rateLimit{lines: 1, per: time.Hour}, maxLineLength: 6},
+			expectedOutput:   "b 1\r\nb 3\n",
+			expectedRejected: "a\n  more\nc\nb 2\nlong line b\nd",
+		},
+		{
+			name:             "rate limited long lines",
+			cli:              CLI{rawPatterns: []string{"b*"}, rateLimit: rateLimit{lines: 1, per: time.Hour}, maxLineLength: 3, longLinePolicy: longLinePass, lineNumbers: true},
+			expectedOutput:   "2:b 1\r\n7:b 3\n",
+			expectedRejected: "a\n  more\nc\nb 2\nlong line b\nd",
+		},
+		{
+			name:             "parallel",
+			cli:              CLI{rawPatterns: []string{"*b*"}, maxLineLength: 6, longLinePolicy: longLineDrop, workers: 3},
+			expectedOutput:   "b 1\r\nb 2\nb 3\n",
+			expectedRejected: "a\n  more\nc\nlong line b\nd",
+		},
+		{
+			name:             "line buffered",
+			cli:              CLI{rawPatterns: []string{"b*"}, lineBuffered: true},
+			expectedOutput:   "b 1\r\nb 2\nb 3\n",
+			expectedRejected: "a\n  more\nc\nlong line b\nd",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			path := t.TempDir() + "/rejected"
+
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "printf"
+			cli.args = []string{"%s", input}
+			cli.rejectedPath = path
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cli.run(); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q", got, tc.expectedOutput)
+			}
+			if got := readRawLog(t, path, false); got != tc.expectedRejected {
+				t.Errorf("rejected = %q, want %q", got, tc.expectedRejected)
+			}
+		})
+	}
+
+	t.Run("fd", func(t *testing.T) {
+		file, err := os.Create(t.TempDir() + "/rejected")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		cli := CLI{
+			Input:        strings.NewReader(""),
+			Output:       &bytes.Buffer{},
+			ErrOut:       &bytes.Buffer{},
+			command:      "printf",
+			args:         []string{`\0a\nb\n`},
+			binaryPolicy: binarySkip,
+			rejectedFD:   int(file.Fd()),
+		}
+		if err := cli.run(); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if got := readRawLog(t, file.Name(), false); got != "\x00a\nb\n" {
+			t.Errorf("rejected = %q", got)
+		}
+	})
+}
+
+func TestCLI_run_stderr(t *testing.T) {
+	const script = `printf 'out 1\nout 2\n'; printf 'warning: a\nerror: b\r\nwarning: c' >&2`
+
+	tests := []struct {
+		name           string
+		cli            CLI
+		expectedOutput string
+		expectedStderr string
+		expectedError  error
+	}{
+		{
+			name:           "passed through",
+			cli:            CLI{rawPatterns: []string{"out 1"}},
+			expectedOutput: "out 1\n",
+			expectedStderr: "warning: a\nerror: b\r\nwarning: c",
+		},
+		{
+			name:           "filtered",
+			cli:            CLI{rawPatterns: []string{"out 1"}, stderrRawPatterns: []string{"error:*"}},
+			expectedOutput: "out 1\n",
+			expectedStderr: "error: b\r\n",
+		},
+		{
+			name:           "inverted",
+			cli:            CLI{invertMatch: true, stderrRawPatterns: []string{"error:*"}, stderrInvert: true},
+			expectedOutput: "out 1\nout 2\n",
+			expectedStderr: "warning: a\nwarning: c",
+		},
+		{
+			name:           "inverted without patterns",
+			cli:            CLI{stderrInvert: true},
+			expectedOutput: "",
+			expectedStderr: "warning: a\nerror: b\r\nwarning: c",
+		},
+		{
+			name:           "long lines",
+			cli:            CLI{stderrRawPatterns: []string{"*:*"}, maxLineLength: 8},
+			expectedOutput: "",
+			expectedStderr: "warning:\nerror: b\r\nwarning:",
+		},
+		{
+			name:           "long lines dropped",
+			cli:            CLI{stderrRawPatterns: []string{"*:*"}, maxLineLength: 9, longLinePolicy: longLineDrop},
+			expectedOutput: "",
+			expectedStderr: "Warning: dropped line 1 (10 bytes), exceeding --max-line-length\nerror: b\r\nWarning: dropped line 3 (10 bytes), exceeding --max-line-length\n",
+		},
+		{
+			name:           "per-pattern limit",
+			cli:            CLI{stderrRawPatterns: []string{"warning:*"}, perPatternLimit: 1},
+			expectedOutput: "",
+			expectedStderr: "warning: a\npattern \"warning:*\" suppressed 1 more line\n",
+		},
+		{
+			name:           "parallel",
+			cli:            CLI{stderrRawPatterns: []string{"warning:*"}, workers: 2},
+			expectedOutput: "",
+			expectedStderr: "warning: a\nwarning: c",
+		},
+		{
+			name:           "error mode ignores stderr",
+			cli:            CLI{rawPatterns: []string{"none"}, errorMode: errorModeNoContent},
+			expectedOutput: "",
+			expectedStderr: "warning: a\nerror: b\r\nwarning: c",
+			expectedError:  errDueToMode,
+		},
+		{
+			name:           "error mode stderr passed through",
+			cli:            CLI{rawPatterns: []string{"none"}, errorMode: errorModeNoContent, errorModeStderr: true},
+			expectedOutput: "",
+			expectedStderr: "warning: a\nerror: b\r\nwarning: c",
+		},
+		{
+			name:           "error mode stderr filtered",
+			cli:            CLI{stderrRawPatterns: []string{"error:*"}, errorMode: errorModeOnContent, errorModeStderr: true},
+			expectedOutput: "",
+			expectedStderr: "error: b\r\n",
+			expectedError:  errDueToMode,
+		},
+		{
+			name:           "error mode stderr filtered out",
+			cli:            CLI{stderrRawPatterns: []string{"none"}, errorMode: errorModeOnContent, errorModeStderr: true},
+			expectedOutput: "",
+			expectedStderr: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "bash"
+			cli.args = []string{"-c", script}
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cli.run(); !errors.Is(err, tc.expectedError) {
+				t.Fatalf("run() error = %v, want %v", err, tc.expectedError)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q", got, tc.expectedOutput)
+			}
+			if got := stderr.String(); got != tc.expectedStderr {
+				t.Errorf("stderr = %q, want %q", got, tc.expectedStderr)
+			}
+		})
+	}
+
+	t.Run("killed", func(t *testing.T) {
+		var stderr bytes.Buffer
+		cli := CLI{
+			Input:             strings.NewReader(""),
+			Output:            &bytes.Buffer{},
+			ErrOut:            &stderr,
+			command:           "bash",
+			args:              []string{"-c", `echo error: a >&2; (sleep 10 >&2 &); sleep 0.1; echo out; sleep 10`},
+			rawPatterns:       []string{"out"},
+			stderrRawPatterns: []string{"error:*"},
+			maxCount:          1,
+			maxCountAction:    maxCountKill,
+		}
+		if err := cli.loadAndCompilePatterns(); err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if err := cli.run(); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("run() took %s", elapsed)
+		}
+		if got := stderr.String(); got != "error: a\n" {
+			t.Errorf("stderr = %q", got)
+		}
+	})
+}
+
+func TestCLI_run_merge(t *testing.T) {
+	// N.B. the delays ensure the order the lines are read in
+	const script = `echo out 1; sleep 0.05; echo err 1 >&2; sleep 0.05; echo out 2; sleep 0.05; printf 'err 2 long' >&2`
+
+	patternFile := filepath.Join(t.TempDir(), "stream.patterns")
+	if err := os.WriteFile(patternFile, []byte("out 2\nerr * #!scof stream=err\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		cli              CLI
+		expectedOutput   string
+		expectedRejected string
+		expectedError    error
+	}{
+		{
+			name:             "merged",
+			cli:              CLI{invertMatch: true},
+			expectedOutput:   "out 1\nerr 1\nout 2\nerr 2 long",
+			expectedRejected: "",
+		},
+		{
+			name:             "text tags",
+			cli:              CLI{invertMatch: true, streamTags: streamTagsText, lineNumbers: true},
+			expectedOutput:   "[out] 1:out 1\n[err] 2:err 1\n[out] 3:out 2\n[err] 4:err 2 long",
+			expectedRejected: "",
+		},
+		{
+			name:             "color tags",
+			cli:              CLI{invertMatch: true, streamTags: streamTagsColor},
+			expectedOutput:   "out 1\n\x1b[31merr 1\x1b[0m\nout 2\n\x1b[31merr 2 long\x1b[0m",
+			expectedRejected: "",
+		},
+		{
+			name:             "stream patterns",
+			cli:              CLI{patternFiles: []string{patternFile}, streamTags: streamTagsText},
+			expectedOutput:   "[err] err 1\n[out] out 2\n[err] err 2 long",
+			expectedRejected: "out 1\n",
+		},
+		{
+			name:             "long lines",
+			cli:              CLI{invertMatch: true, streamTags: streamTagsColor, maxLineLength: 5, longLinePolicy: longLinePass, workers: 2},
+			expectedOutput:   "out 1\n\x1b[31merr 1\x1b[0m\nout 2\n\x1b[31merr 2 long\x1b[0m",
+			expectedRejected: "",
+		},
+		{
+			name:             "max count",
+			cli:              CLI{rawPatterns: []string{"out *"}, maxCount: 1},
+			expectedOutput:   "out 1\n",
+			expectedRejected: "err 1\nout 2\nerr 2 long",
+		},
+		{
+			name:             "error mode",
+			cli:              CLI{rawPatterns: []string{"err 1"}, errorMode: errorModeOnContent},
+			expectedOutput:   "err 1\n",
+			expectedRejected: "out 1\nout 2\nerr 2 long",
+			expectedError:    errDueToMode,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			path := t.TempDir() + "/rejected"
+
+			cli := tc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = &stdout
+			cli.ErrOut = &stderr
+			cli.command = "bash"
+			cli.args = []string{"-c", script}
+			cli.merge = true
+			cli.rejectedPath = path
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cli.run(); !errors.Is(err, tc.expectedError) {
+				t.Fatalf("run() error = %v, want %v", err, tc.expectedError)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q", got, tc.expectedOutput)
+			}
+			if got := stderr.String(); got != "" {
+				t.Errorf("stderr = %q", got)
+			}
+			if got := readRawLog(t, path, false); got != tc.expectedRejected {
+				t.Errorf("rejected = %q, want %q", got, tc.expectedRejected)
+			}
+		})
+	}
+
+	t.Run("killed", func(t *testing.T) {
+		var stdout bytes.Buffer
+		cli := CLI{
+			Input:          strings.NewReader(""),
+			Output:         &stdout,
+			ErrOut:         &bytes.Buffer{},
+			command:        "bash",
+			args:           []string{"-c", `(sleep 10 &); echo err 1 >&2; sleep 0.05; echo out; sleep 10`},
+			rawPatterns:    []string{"err *"},
+			merge:          true,
+			maxCount:       1,
+			maxCountAction: maxCountKill,
+		}
+		if err := cli.loadAndCompilePatterns(); err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if err := cli.run(); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("run() took %s", elapsed)
+		}
+		if got := stdout.String(); got != "err 1\n" {
+			t.Errorf("stdout = %q", got)
+		}
+	})
+}
+
+func TestCLI_run_binary(t *testing.T) {
+	const (
+		binaryScript = `printf 'keep\x00\xff\nother\nkeep 2\n'`
+		textScript   = `printf 'keep\nother\n'`
+	)
+
+	tests := []struct {
+		name           string
+		script         string
+		policy         binaryPolicy
+		errorMode      errorMode
+		expectedOutput string
+		expectedError  error
+	}{
+		{
+			name:           "text",
+			script:         binaryScript,
+			policy:         binaryText,
+			expectedOutput: "keep\x00\xff\nkeep 2\n",
+		},
+		{
+			name:           "skip",
+			script:         binaryScript,
+			policy:         binarySkip,
+			errorMode:      errorModeNoContent,
+			expectedOutput: "",
+			expectedError:  errDueToMode,
+		},
+		{
+			name:           "pass",
+			script:         binaryScript,
+			policy:         binaryPass,
+			errorMode:      errorModeOnContent,
+			expectedOutput: "keep\x00\xff\nother\nkeep 2\n",
+			expectedError:  errDueToMode,
+		},
+		{
+			name:           "summary",
+			script:         binaryScript,
+			policy:         binarySummary,
+			expectedOutput: "Binary output matches\n",
+		},
+		{
+			name:           "summary no match",
+			script:         `printf 'other\x00\n'`,
+			policy:         binarySummary,
+			errorMode:      errorModeNoContent,
+			expectedOutput: "",
+			expectedError:  errDueToMode,
+		},
+		{
+			name:           "skip after the first read",
+			script:         `printf 'keep\n'; printf 'keep\x00\n'`,
+			policy:         binarySkip,
+			expectedOutput: "",
+		},
+		{
+			name:           "skip text",
+			script:         textScript,
+			policy:         binarySkip,
+			expectedOutput: "keep\n",
+		},
+		{
+			name:           "pass text",
+			script:         textScript,
+			policy:         binaryPass,
+			expectedOutput: "keep\n",
+		},
+		{
+			name:           "summary text",
+			script:         textScript,
+			policy:         binarySummary,
+			expectedOutput: "keep\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			cli := &CLI{
+				Input:            strings.NewReader(""),
+				Output:           &stdout,
+				ErrOut:           &stderr,
+				command:          "bash",
+				args:             []string{"-c", tc.script},
+				compiledPatterns: []*regexp.Regexp{compileSinglePattern("keep*")},
+				binaryPolicy:     tc.policy,
+				errorMode:        tc.errorMode,
+			}
+
+			if err := cli.run(); !errors.Is(err, tc.expectedError) {
+				t.Fatalf("run() error = %v, want %v", err, tc.expectedError)
+			}
+
+			if got := stdout.String(); got != tc.expectedOutput {
+				t.Errorf("stdout = %q, want %q (stderr %q)", got, tc.expectedOutput, stderr.String())
+			}
+		})
+	}
+}
+
+// benchmarkOutputSize is the size of the command's output, for each
+// iteration of BenchmarkCLI_run, e.g. use -benchtime=5x for 5GiB, though
+// the (CPU bound) cases with many patterns use 1/64th of this.
+const benchmarkOutputSize = 1 << 30
+
+// benchmarkPatterns are enough patterns to match in parallel by default.
+var benchmarkPatterns = func() []string {
+	var patterns []string
+	for i := range 2 * parallelPatternThreshold {
+		patterns = append(patterns, fmt.Sprintf("* status=%d *", 300+i))
+	}
+	return patterns
+}()
+
+func BenchmarkCLI_run(b *testing.B) {
+	devNull, err := os.Create(os.DevNull)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+
+	for _, bc := range []struct {
+		name string
+		cli  CLI
+		size int64
+	}{
+		{name: "keep none", cli: CLI{rawPatterns: []string{"*ERROR*"}}},
+		{name: "keep all", cli: CLI{invertMatch: true}},
+		{name: "keep all line buffered", cli: CLI{invertMatch: true, lineBuffered: true}},
+		{name: "many patterns", cli: CLI{rawPatterns: benchmarkPatterns, workers: 1}, size: benchmarkOutputSize / 64},
+		{name: "many patterns parallel", cli: CLI{rawPatterns: benchmarkPatterns}, size: benchmarkOutputSize / 64},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			size := bc.size
+			if size == 0 {
+				size = benchmarkOutputSize
+			}
+			cli := bc.cli
+			cli.Input = strings.NewReader("")
+			cli.Output = devNull
+			cli.ErrOut = devNull
+			cli.command = "bash"
+			cli.args = []string{"-c", fmt.Sprintf(`yes '2006-01-02T15:04:05Z INFO request handled path=/api/v1/items status=200 duration=17 ms' | head -c %d`, size)}
+			if err := cli.loadAndCompilePatterns(); err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(size)
+			for b.Loop() {
+				if err := cli.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
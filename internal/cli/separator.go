@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// resolveRecordSeparator validates the -z, --record-separator, and
+// --record-separator-regex options, which are mutually exclusive, setting
+// separator or separatorRegex, if any were given.
+func (x *CLI) resolveRecordSeparator() error {
+	var n int
+	for _, set := range [...]bool{x.nullData, x.recordSeparator != ``, x.recordSeparatorRegex != ``} {
+		if set {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	if n > 1 {
+		return errors.New("invalid record separator: -z, --record-separator, and --record-separator-regex are mutually exclusive")
+	}
+	if x.crSegments {
+		return errors.New("invalid record separator: cannot be combined with --cr-segments")
+	}
+
+	switch {
+	case x.nullData:
+		x.separator = []byte{0}
+
+	case x.recordSeparator != ``:
+		separator, err := unescapeSeparator(x.recordSeparator)
+		if err != nil {
+			return fmt.Errorf("invalid record separator %q: %w", x.recordSeparator, err)
+		}
+		x.separator = separator
+
+	default:
+		re, err := regexp.Compile(x.recordSeparatorRegex)
+		if err != nil {
+			return fmt.Errorf("invalid record separator regex %q: %w", x.recordSeparatorRegex, err)
+		}
+		if re.MatchString(``) {
+			return fmt.Errorf("invalid record separator regex %q: must not match the empty string", x.recordSeparatorRegex)
+		}
+		x.separatorRegex = re
+	}
+
+	return nil
+}
+
+// unescapeSeparator interprets the escape sequences \\, \0, \n, \r, \t, and
+// \xHH, in s, returning the resulting bytes.
+func unescapeSeparator(s string) ([]byte, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return nil, errors.New("trailing backslash")
+		}
+		switch s[i] {
+		case '\\':
+			b = append(b, '\\')
+		case '0':
+			b = append(b, 0)
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, errors.New(`incomplete \x escape`)
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf(`invalid \x escape %q`, s[i-1:i+3])
+			}
+			b = append(b, byte(v))
+			i += 2
+		default:
+			return nil, fmt.Errorf("unknown escape %q", s[i-1:i+1])
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_unescapeSeparator(t *testing.T) {
+	for _, tc := range [...]struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{input: `\0`, expected: "\x00"},
+		{input: `\n---\n`, expected: "\n---\n"},
+		{input: `a\r\t\\b`, expected: "a\r\t\\b"},
+		{input: `\x1e`, expected: "\x1e"},
+		{input: `\xFFz`, expected: "\xffz"},
+		{input: `;`, expected: ";"},
+		{input: `a\`, err: "trailing backslash"},
+		{input: `\x1`, err: `incomplete \x escape`},
+		{input: `\xzz`, err: `invalid \x escape "\\xzz"`},
+		{input: `\q`, err: `unknown escape "\\q"`},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			b, err := unescapeSeparator(tc.input)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.expected {
+				t.Errorf("got %q, want %q", b, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCLI_resolveRecordSeparator(t *testing.T) {
+	for _, tc := range [...]struct {
+		name      string
+		cli       CLI
+		separator string
+		regex     string
+		err       string
+	}{
+		{name: "none"},
+		{name: "null data", cli: CLI{nullData: true}, separator: "\x00"},
+		{name: "byte string", cli: CLI{recordSeparator: `\n\n`}, separator: "\n\n"},
+		{name: "regex", cli: CLI{recordSeparatorRegex: `\n{2,}`}, regex: `\n{2,}`},
+		{name: "exclusive", cli: CLI{nullData: true, recordSeparator: `;`}, err: "mutually exclusive"},
+		{name: "cr segments", cli: CLI{nullData: true, crSegments: true}, err: "--cr-segments"},
+		{name: "invalid escape", cli: CLI{recordSeparator: `\`}, err: "trailing backslash"},
+		{name: "invalid regex", cli: CLI{recordSeparatorRegex: `(`}, err: "invalid record separator regex"},
+		{name: "empty regex match", cli: CLI{recordSeparatorRegex: `;*`}, err: "must not match the empty string"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cli.resolveRecordSeparator()
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(tc.cli.separator) != tc.separator {
+				t.Errorf("separator = %q, want %q", tc.cli.separator, tc.separator)
+			}
+			var regex string
+			if tc.cli.separatorRegex != nil {
+				regex = tc.cli.separatorRegex.String()
+			}
+			if regex != tc.regex {
+				t.Errorf("separatorRegex = %q, want %q", regex, tc.regex)
+			}
+		})
+	}
+}
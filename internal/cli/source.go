@@ -0,0 +1,380 @@
+package cli
+
+import (
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// parallelPatternThreshold is the number of patterns, at or above which
+	// lines are matched in parallel, by default (see --workers).
+	parallelPatternThreshold = 64
+
+	// batchLines and batchBytes bound the size of each batch of lines, when
+	// matching in parallel, though a single line may exceed batchBytes.
+	batchLines = 256
+	batchBytes = 64 * 1024
+)
+
+// scannedLine is a line read from the command, and the result of matching
+// it, if applicable.
+type scannedLine struct {
+	info     lineInfo
+	text     []byte      // the line, excluding the terminator, possibly truncated
+	line     []byte      // text, and the terminator
+	long     bool        // exceeds the max line length
+	rest     bool        // the remainder of the long line is unread, see unread
+	cont     bool        // continues the previous segment's line, see lineScanner
+	m        *matcher    // if matched
+	index    int         // of the first matching pattern, or -1
+	excluded bool        // matched an excluding pattern, see matcher.excluded
+	buf      []byte      // storage for line, if copied
+	reader   *lineReader // that the line was read from, see unread
+}
+
+// unread returns true if l is a long line to be passed through or dropped,
+// or truncated, but possibly rejected (see lineScanner), in which case its
+// remainder must be read from l.reader, by the caller (e.g. to copy it to
+// --rejected).
+func (l *scannedLine) unread() bool {
+	return l.rest
+}
+
+// streamed returns true if long lines are passed through or dropped, per
+// policy, rather than matched.
+func (policy longLinePolicy) streamed() bool {
+	return policy == longLinePass || policy == longLineDrop
+}
+
+// lineSource yields the lines read from the command, in order, matched
+// against the active patterns.
+type lineSource interface {
+	// next returns the next line, which is valid until the following call,
+	// or false once there are no more lines (see lineReader.Err).
+	next() (*scannedLine, bool)
+
+	// idle returns true if next may block, waiting for the command.
+	idle() bool
+
+	// wait waits at most d for next to no longer block, returning false if
+	// the command is still idle. It may return true early, e.g. if the
+	// input doesn't support deadlines.
+	wait(d time.Duration) bool
+
+	// close stops reading, after which next yields only the lines already
+	// read, if any, then the lineReader may be used directly. It may block
+	// until the command writes or exits.
+	close()
+
+	// drain writes all remaining input, exactly as read, to w, e.g. once
+	// --max-count is reached. The remainder of the line last returned by
+	// next, if it was left unread, must have been consumed.
+	drain(w io.Writer)
+}
+
+// lineScanner scans and numbers lines, applying the long line policy, which
+// is common to all lineSource implementations. With --cr-segments, segments
+// share the number of the line they're part of, so numbers match the
+// unfiltered output.
+//
+// The remainder of truncated lines is discarded, unless rejectRest is set, in
+// which case it's left unread, so it may be copied to --rejected, if the
+// line isn't kept.
+type lineScanner struct {
+	reader     *lineReader
+	policy     longLinePolicy
+	timestamps bool // capture the time each line was read
+	stderr     bool // the lines are from stderr, see --merge
+	rejectRest bool // leave the remainder of truncated lines unread
+	number     int
+}
+
+func (s *lineScanner) scan(l *scannedLine) bool {
+	// N.B. the previous segment must be read in full, by now
+	cont := s.reader.crSegments && string(s.reader.terminator()) == "\r"
+	if !s.reader.scan() {
+		return false
+	}
+	if !cont {
+		s.number++
+	}
+	l.cont = cont
+	l.info.number = s.number
+	if s.timestamps {
+		// N.B. captured as soon as the line was read
+		l.info.read = time.Now()
+	}
+	l.info.stderr = s.stderr
+	l.reader = s.reader
+	l.long = s.reader.long
+	l.rest = l.long && (s.policy.streamed() || s.rejectRest)
+	if l.long && !l.rest {
+		// truncate, though the terminator is still needed
+		_, _ = s.reader.discardRest()
+	}
+	l.text = s.reader.bytes()
+	l.line = s.reader.line()
+	return true
+}
+
+// match sets the result of matching l against m.
+func (s *lineScanner) match(m *matcher, l *scannedLine) {
+	l.m = m
+	l.index = -1
+	l.excluded = false
+	if !l.long || !s.policy.streamed() {
+		l.index = m.matchStream(l.text, l.info.stderr)
+		l.excluded = m.excluded(l.text, l.info.stderr)
+	}
+}
+
+// drainClosed implements lineSource.drain, for sources where, once closed,
+// the remaining input may be copied from the lineReader directly.
+func drainClosed(s lineSource, reader *lineReader, w io.Writer) {
+	s.close()
+	for l, ok := s.next(); ok; l, ok = s.next() {
+		_, _ = w.Write(l.line)
+	}
+	_, _ = reader.copyAll(w)
+}
+
+// newLineSource returns a lineSource, which matches lines in parallel, if
+// there are multiple workers (see --workers).
+func (x *CLI) newLineSource(reader *lineReader, active *atomic.Pointer[matcher], timestamps, rejectRest bool) lineSource {
+	scanner := lineScanner{
+		reader:     reader,
+		policy:     x.longLinePolicy,
+		timestamps: timestamps,
+		rejectRest: rejectRest,
+	}
+	workers := x.matchWorkers(len(active.Load().patterns))
+	if workers <= 1 {
+		return &serialSource{lineScanner: scanner, active: active}
+	}
+	return newParallelSource(scanner, active, workers)
+}
+
+// matchWorkers returns the number of goroutines to match lines with.
+func (x *CLI) matchWorkers(patterns int) int {
+	if x.workers > 0 {
+		return x.workers
+	}
+	if patterns < parallelPatternThreshold {
+		return 1
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// serialSource matches each line as it is read.
+type serialSource struct {
+	lineScanner
+	active *atomic.Pointer[matcher]
+	line   scannedLine
+	closed bool
+}
+
+func (s *serialSource) next() (*scannedLine, bool) {
+	if s.closed || !s.scan(&s.line) {
+		return nil, false
+	}
+	s.match(s.active.Load(), &s.line)
+	return &s.line, true
+}
+
+func (s *serialSource) idle() bool {
+	return !s.reader.ready()
+}
+
+func (s *serialSource) wait(d time.Duration) bool {
+	return s.reader.wait(d)
+}
+
+func (s *serialSource) close() {
+	s.closed = true
+}
+
+func (s *serialSource) drain(w io.Writer) {
+	drainClosed(s, s.reader, w)
+}
+
+// lineBatch is a batch of lines, matched by a single worker.
+type lineBatch struct {
+	lines []scannedLine // reused, only the first n are valid
+	n     int
+	done  chan struct{} // signaled once matched
+}
+
+// parallelSource reads lines in batches, which are matched by a pool of
+// workers, then yielded in their original order. Memory use is bounded by
+// the number of batches, and, once they are all in use, reading stops,
+// applying back-pressure to the command.
+//
+// Long lines that are passed through (or dropped) are always the last line
+// of a batch, and reading stops until the caller moves on to the next line,
+// so the caller may use the lineReader directly.
+type parallelSource struct {
+	lineScanner
+	active  *atomic.Pointer[matcher]
+	free    chan *lineBatch
+	work    chan *lineBatch
+	ordered chan *lineBatch
+	resume  chan struct{} // continue reading, after an unread line
+	stop    chan struct{}
+	stopped sync.Once
+	wg      sync.WaitGroup
+	batch   *lineBatch // being yielded
+	pending *lineBatch // received by wait, to be yielded next
+	i       int        // of the next line of batch
+	passing bool       // the last line yielded was unread
+}
+
+func newParallelSource(scanner lineScanner, active *atomic.Pointer[matcher], workers int) *parallelSource {
+	batches := 2 * workers
+	s := &parallelSource{
+		lineScanner: scanner,
+		active:      active,
+		free:        make(chan *lineBatch, batches),
+		work:        make(chan *lineBatch, batches),
+		ordered:     make(chan *lineBatch, batches),
+		resume:      make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	for range batches {
+		s.free <- &lineBatch{done: make(chan struct{}, 1)}
+	}
+	s.wg.Add(1 + workers)
+	go s.read()
+	for range workers {
+		go s.matchBatches()
+	}
+	return s
+}
+
+func (s *parallelSource) read() {
+	defer s.wg.Done()
+	defer close(s.ordered)
+	defer close(s.work)
+
+	var line scannedLine
+	for {
+		var batch *lineBatch
+		select {
+		case batch = <-s.free:
+		case <-s.stop:
+			return
+		}
+
+		var (
+			size int
+			more bool
+		)
+		for batch.n = 0; ; {
+			if more = s.scan(&line); !more {
+				break
+			}
+			if batch.n == len(batch.lines) {
+				batch.lines = append(batch.lines, scannedLine{})
+			}
+			l := &batch.lines[batch.n]
+			buf := append(l.buf[:0], line.line...)
+			*l = line
+			l.buf, l.line, l.text = buf, buf, buf[:len(line.text)]
+			batch.n++
+			size += len(buf)
+			// N.B. sent as soon as reading may block, to avoid delaying lines
+			if l.unread() || batch.n == batchLines || size >= batchBytes || !s.reader.ready() {
+				break
+			}
+		}
+
+		if batch.n != 0 {
+			// N.B. never blocks, as there are only as many batches as capacity
+			s.work <- batch
+			s.ordered <- batch
+		}
+		if !more {
+			return
+		}
+
+		if batch.lines[batch.n-1].unread() {
+			select {
+			case <-s.resume:
+			case <-s.stop:
+				return
+			}
+		}
+	}
+}
+
+func (s *parallelSource) matchBatches() {
+	defer s.wg.Done()
+	for batch := range s.work {
+		m := s.active.Load()
+		for i := range batch.lines[:batch.n] {
+			s.match(m, &batch.lines[i])
+		}
+		batch.done <- struct{}{}
+	}
+}
+
+func (s *parallelSource) next() (*scannedLine, bool) {
+	if s.passing {
+		s.passing = false
+		s.resume <- struct{}{}
+	}
+	for s.batch == nil || s.i == s.batch.n {
+		if s.batch != nil {
+			s.free <- s.batch
+			s.batch = nil
+		}
+		batch, ok := s.pending, true
+		if batch != nil {
+			s.pending = nil
+		} else {
+			batch, ok = <-s.ordered
+		}
+		if !ok {
+			return nil, false
+		}
+		<-batch.done
+		s.batch, s.i = batch, 0
+	}
+	l := &s.batch.lines[s.i]
+	s.i++
+	s.passing = l.unread()
+	return l, true
+}
+
+func (s *parallelSource) idle() bool {
+	return (s.batch == nil || s.i == s.batch.n) && s.pending == nil && len(s.ordered) == 0
+}
+
+func (s *parallelSource) wait(d time.Duration) bool {
+	if !s.idle() {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case batch, ok := <-s.ordered:
+		// N.B. once closed, next won't block
+		if ok {
+			s.pending = batch
+		}
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (s *parallelSource) close() {
+	s.stopped.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+func (s *parallelSource) drain(w io.Writer) {
+	drainClosed(s, s.reader, w)
+}
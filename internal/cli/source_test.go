@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestMatcher(patterns ...string) *atomic.Pointer[matcher] {
+	m := &matcher{}
+	for _, p := range patterns {
+		m.patterns = append(m.patterns, regexp.MustCompile(p))
+	}
+	var active atomic.Pointer[matcher]
+	active.Store(m)
+	return &active
+}
+
+func Test_parallelSource(t *testing.T) {
+	const lines = 20000
+
+	var input strings.Builder
+	for i := 1; i <= lines; i++ {
+		if i%1000 == 0 {
+			// long lines, passed through
+			fmt.Fprintf(&input, "%d %s\n", i, strings.Repeat("x", 100))
+		} else {
+			fmt.Fprintf(&input, "%d\n", i)
+		}
+	}
+
+	reader := newLineReader(strings.NewReader(input.String()), 50)
+	s := (&CLI{workers: 4, longLinePolicy: longLinePass}).newLineSource(reader, newTestMatcher(`0$`, `5$`), false, false)
+	defer s.close()
+	if _, ok := s.(*parallelSource); !ok {
+		t.Fatalf("got %T", s)
+	}
+
+	for i := 1; i <= lines; i++ {
+		l, ok := s.next()
+		if !ok {
+			t.Fatalf("line %d: no more lines", i)
+		}
+		if l.info.number != i {
+			t.Fatalf("line %d: number %d", i, l.info.number)
+		}
+		if i%1000 == 0 {
+			if !l.long || !strings.HasPrefix(string(l.text), fmt.Sprint(i)) {
+				t.Fatalf("line %d: got %q", i, l.text)
+			}
+			var rest strings.Builder
+			if n, _ := reader.copyRest(&rest); n != int64(len(fmt.Sprint(i))+101-50) || string(reader.terminator()) != "\n" {
+				t.Fatalf("line %d: got rest %q", i, rest.String())
+			}
+			continue
+		}
+		expected := -1
+		switch i % 10 {
+		case 0:
+			expected = 0
+		case 5:
+			expected = 1
+		}
+		if string(l.line) != fmt.Sprintf("%d\n", i) || l.index != expected {
+			t.Fatalf("line %d: got %q, index %d", i, l.line, l.index)
+		}
+	}
+	if l, ok := s.next(); ok {
+		t.Fatalf("unexpected line %q", l.line)
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_parallelSource_backPressure(t *testing.T) {
+	r, w := io.Pipe()
+	var written atomic.Int64
+	go func() {
+		defer w.Close()
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "%d\n", i); err != nil {
+				return
+			}
+			written.Add(1)
+		}
+	}()
+
+	const workers = 2
+	s := (&CLI{workers: workers}).newLineSource(newLineReader(r, 0), newTestMatcher(`.`), false, false)
+
+	// N.B. nothing is consumed, so reading must stop, once all the batches
+	// are full, though each read is a single line, so batches are small
+	time.Sleep(100 * time.Millisecond)
+	if n := written.Load(); n > 2*workers+1 {
+		t.Errorf("written %d lines", n)
+	}
+
+	for i := range 1000 {
+		l, ok := s.next()
+		if !ok || string(l.line) != fmt.Sprintf("%d\n", i) || l.index != 0 {
+			t.Fatalf("line %d: got %q", i, l.line)
+		}
+	}
+
+	// N.B. unblocks the reader
+	_ = r.Close()
+	s.close()
+}
+
+func TestCLI_matchWorkers(t *testing.T) {
+	if n := (&CLI{}).matchWorkers(parallelPatternThreshold - 1); n != 1 {
+		t.Errorf("got %d workers", n)
+	}
+	if n := (&CLI{workers: 3}).matchWorkers(1); n != 3 {
+		t.Errorf("got %d workers", n)
+	}
+	if n := (&CLI{workers: 1}).matchWorkers(1000); n != 1 {
+		t.Errorf("got %d workers", n)
+	}
+	if _, ok := (&CLI{workers: 1}).newLineSource(newLineReader(strings.NewReader(""), 0), newTestMatcher(), false, false).(*serialSource); !ok {
+		t.Error("expected a serialSource")
+	}
+}
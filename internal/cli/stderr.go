@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// stderrFiltered returns true if the command's stderr is filtered, rather
+// than passed through (see --stderr-pattern).
+func (x *CLI) stderrFiltered() bool {
+	return len(x.stderrRawPatterns) != 0 || len(x.stderrPatternFiles) != 0 || x.stderrInvert
+}
+
+// stderrPiped returns true if the command's stderr is read, rather than
+// passed through, i.e. if it is filtered, or counted (see --error-mode-stderr).
+func (x *CLI) stderrPiped() bool {
+	return x.stderrFiltered() || x.errorModeStderr
+}
+
+// filterStderr filters the command's stderr, read from r, until EOF,
+// writing the kept lines to w, exactly as read, and returning true if any
+// were kept, where active is the matcher for the stderr patterns. Lines are
+// newline terminated (or per --cr-segments), and are subject to the long line
+// policy, and per-pattern limits, but are otherwise only matched against the
+// patterns (see stderrCLI). If stderr isn't filtered, it's copied as-is.
+func (x *CLI) filterStderr(r io.Reader, w io.Writer, active *atomic.Pointer[matcher]) (content bool) {
+	if !x.stderrFiltered() {
+		n, _ := io.Copy(w, r)
+		return n != 0
+	}
+
+	s := x.stderrCLI()
+
+	reader := newLineReader(r, s.maxLineLength)
+	reader.crSegments = s.crSegments
+
+	// N.B. notices, e.g. of dropped lines, are also written to stderr
+	f := s.newLineFilter(w, w, nil, nil, false)
+
+	source := s.newLineSource(reader, active, false, false)
+	defer source.close()
+
+	for {
+		l, ok := source.next()
+		if !ok {
+			break
+		}
+		f.line(l)
+	}
+	f.finish()
+	return f.content
+}
+
+// stderrCLI returns the options that apply to the command's stderr, when it
+// is filtered, see filterStderr.
+func (x *CLI) stderrCLI() *CLI {
+	return &CLI{
+		maxLineLength:  x.maxLineLength,
+		longLinePolicy: x.longLinePolicy,
+		crSegments:     x.crSegments,
+		workers:        x.workers,
+		invertMatch:    x.stderrInvert,
+	}
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 )
@@ -18,29 +19,221 @@ DESCRIPTION:
   status is preserved.
 
 PATTERNS:
-  - Patterns match the entire line from start to end.
+  - Patterns match the entire line from start to end, excluding the line
+    terminator ('\n' or '\r\n'). Lines are output exactly as they were read,
+    including the original terminator (or lack of one, for the last line).
   - '*' (asterisk) is a wildcard, matching zero or more characters.
   - '**' (double asterisk) matches a literal asterisk character.
   - All other characters are matched literally.
+  - With --path-glob, patterns are instead path globs, for filtering lists of
+    file paths: '*' matches zero or more characters other than '/', '**' as
+    an entire path segment (e.g. 'src/**/*.go') matches any number of
+    directories, and '\' escapes the next character (e.g. '\*' matches a
+    literal asterisk).
   - Patterns can be specified via -p/--pattern flags or -f/--pattern-file flags.
   - If multiple patterns are provided, a line is considered a match if it
     matches ANY of the patterns.
 
 PATTERN FILES:
+  - -f/--pattern-file accepts a file, a directory (loading every *.patterns
+    file directly within it, in lexical order), or a shell-style glob.
   - Each line in a pattern file is treated as a separate pattern.
   - Empty lines in pattern files are ignored.
   - Pattern file lines are only read until the first '#' character, unless
     doubled ('##'), which is treated as a literal '#'.
   - If a pattern file line contains a comment, any whitespace immediately
     preceding the comment is ignored.
+  - The first line may be a directive header, setting options for just that
+    file, e.g. '#!scof syntax=regex case=insensitive anchor=none':
+      - syntax: 'wildcard' (default), 'path-glob' (default with --path-glob),
+        or 'regex' (Go RE2 syntax).
+      - case: 'sensitive' (default) or 'insensitive'.
+      - anchor: 'line' (default, match the entire line) or 'none' (match
+        anywhere in the line).
+      - limit: the maximum number of lines each pattern may keep, or 'none',
+        see PER-PATTERN LIMITS.
+      - stream: 'any' (default), 'out', or 'err', restricting patterns to
+        lines from stdout or stderr, see MERGED OUTPUT.
+      - exclude: 'false' (default) or 'true', in which case lines matching
+        the patterns are suppressed, regardless of other patterns, or -v.
+        If every pattern is excluding, all other lines are kept.
+    The '#' comment rules still apply, so regexes must use '##' for '#'.
+  - The same directives may follow a pattern, as a comment, setting options
+    for just that pattern, e.g. 'deprecated: * #!scof limit=5'.
+  - A leading UTF-8 byte order mark, and CRLF line endings, are ignored.
+  - With --strict-patterns, pattern files are rejected (reporting
+    file:line:col) if they contain invalid UTF-8, tabs or other control
+    characters, trailing whitespace, or a directive header after the first
+    line.
+  - With --reload-interval, pattern files are polled for changes while the
+    command runs, and all patterns are reloaded when any file changes, as
+    are the stderr patterns, for --stderr-pattern-file. If the reload
+    fails, a warning is written to stderr, and the previous patterns are
+    kept. Signals (including SIGHUP) are still forwarded to the command.
+
+PER-PATTERN LIMITS (--per-pattern-limit):
+  The number of lines (or multi-line records) each pattern may keep may be
+  limited, globally, via --per-pattern-limit N, or per pattern, via the
+  'limit' directive (see PATTERN FILES). Lines are attributed to the first
+  pattern they match. Once a pattern's limit is reached, further matching
+  lines are suppressed, and, when the command exits, a line is written for
+  each such pattern, e.g. 'pattern "deprecated: *" suppressed 42 more lines'.
+  Limits don't apply with -v/--invert-match.
+
+PRESETS:
+  - Built-in pattern files may be used via --preset NAME, and combined with
+    any other patterns. Use --list-presets to see what is available.
 
 BEHAVIOR WITHOUT PATTERNS:
-  If no patterns are provided (e.g., no -p, --pattern, -f, or --pattern-file flags are used):
+  If no patterns are provided (e.g., no -p, --pattern, -f, --pattern-file, or --preset flags are used):
     - Without -v/--invert-match: no lines will be output from the command's stdout
       (as no lines can match an empty set of patterns).
     - With    -v/--invert-match: all lines will be output from the command's stdout
       (as all lines are considered "non-matching" against an empty set of patterns).
 
+LINE NUMBERS AND TIMESTAMPS (-n, --timestamp):
+  Written lines may be prefixed with their original line number (-n), so
+  they may be found in the unfiltered output, and/or the time they were read
+  (--timestamp), e.g. '[2006-01-02T15:04:05.000Z] 12:text'. Like grep, the
+  line number of a context line is followed by '-', instead of ':'. Formats:
+    - 'wall': (Default) The local time, as RFC 3339, with milliseconds.
+    - 'elapsed': Seconds since the command was started.
+    - Any other value is a Go time layout, e.g. '15:04:05.000'.
+
+REPEATED LINES (--collapse-repeats):
+  Runs of repeated kept lines may be collapsed into the first line, followed
+  by a 'last line repeated N times' line, written once the run ends (any
+  other line is written), when the command exits, or periodically (see
+  --collapse-interval). To ignore volatile parts of lines, such as
+  timestamps, when comparing them, use --collapse-normalize REGEX, e.g.
+  --collapse-normalize '^\S+ \S+ ' --collapse-normalize '0x[0-9a-f]+'.
+
+RATE LIMITING (--rate-limit):
+  Written lines may be limited to a rate of LINES/DURATION, e.g. '100/1s' or
+  '1000/m', allowing bursts of up to LINES lines, to avoid flooding logs.
+  Lines exceeding the rate are dropped (see REJECTED LINES), and counted,
+  with the number dropped written to stderr periodically, and when the
+  command exits. The last 10 lines dropped since anything was written are
+  always written before exiting, so the final lines of output are never
+  hidden.
+
+MULTI-LINE RECORDS (--multiline):
+  Lines may be grouped into multi-line records, such as stack traces, which
+  are then kept or suppressed as a unit. A record matches if any of its lines
+  match. Recognizers (can be specified multiple times, or 'all'):
+    - 'indent': Indented lines continue the previous line.
+    - 'go': Go panics and goroutine dumps.
+    - 'java': Java stack traces ('at ...', 'Caused by: ...').
+    - 'python': Python tracebacks, including the exception line.
+  N.B. a record is only written once the next record starts, the command is
+  idle for 100ms, or at exit.
+
+CONTEXT LINES (-A, -B, -C):
+  Lines surrounding each kept line may also be written, like grep. Use -A N
+  for N lines after, -B N for N lines before, or -C N for both (the larger
+  value wins, if combined with -A or -B). Non-contiguous groups of lines are
+  separated by a '--' line (see --group-separator). Context lines do not
+  count as content, for the error modes.
+
+PROGRESS UPDATES (--cr-segments):
+  Progress bars (e.g. from curl, docker, pip) are typically written as a
+  series of '\r' separated updates, on a single line. With --cr-segments, a
+  lone '\r' is treated as a terminator, so each update (segment) is matched
+  separately, and kept segments are written with their '\r', allowing the
+  progress to animate in a terminal, while suppressed progress disappears.
+  Lines ending in '\r\n' are unaffected, though if the command is idle for
+  10ms after writing the '\r', the '\n' is matched as a line of its own.
+  With -n, segments are numbered by the line they're part of.
+
+RECORD SEPARATORS (-z, --record-separator, --record-separator-regex):
+  By default, output is split into lines. Output may instead be split into
+  records, on NUL bytes (-z, e.g. for 'find -print0' or 'git ls-files -z'),
+  an arbitrary byte string (e.g. --record-separator '\n---\n', supporting the
+  escapes \\, \0, \n, \r, \t, and \xHH), or matches of a regex (which must
+  be no longer than 4KiB, and are treated as complete if they end with the
+  output, and the command is idle for 10ms). Patterns are matched against
+  each record, excluding the separator, and '*' matches newlines. Kept
+  records are written with their original separator.
+
+LONG LINES:
+  Lines may be of any length, but are buffered in full, in order to match
+  them. To bound memory use, set --max-line-length, which applies a policy to
+  longer lines (--long-lines):
+    - 'truncate': (Default) Match and output only the first N bytes.
+    - 'pass': Output the line unfiltered, without buffering the remainder.
+    - 'drop': Suppress the line, writing a notice to stderr.
+
+OUTPUT BUFFERING (--line-buffered):
+  Written lines are buffered, and flushed whenever the command is idle (all
+  of its output so far has been read), within 100ms of being written, and
+  when the command exits. For interactive use, --line-buffered writes each
+  line immediately, at the cost of throughput.
+
+REJECTED LINES (--rejected, --rejected-fd):
+  The lines that weren't kept may be written to a separate file, or an
+  inherited file descriptor, e.g. '--rejected-fd 3 3>rejected.log', exactly
+  as read, which is useful to audit filters. Each line is either written
+  (kept, or as context) or rejected, never both, including lines suppressed
+  due to PER-PATTERN LIMITS, lines read after MAX COUNT is reached (with
+  'drain'), and lines dropped due to --rate-limit, which are rejected once
+  they can't be written at exit, so may be rejected slightly out of order.
+  Repeated lines (see --collapse-repeats) count as kept, as they're
+  summarized. Long lines (see LONG LINES) are rejected in full, unless
+  truncated as part of a multi-line record, so a truncated line is only
+  written as context if it follows a kept line.
+
+STDERR FILTERING (--stderr-pattern, --stderr-pattern-file, --stderr-invert):
+  The command's stderr is passed through as-is, unless it is filtered by
+  its own patterns, which work like -p and -f (including directives), but
+  apply only to stderr, and vice versa. Lines kept are written to stderr,
+  exactly as read. With only --stderr-invert, all lines are kept. Lines are
+  always newline terminated (or per --cr-segments), and --max-line-length
+  and PER-PATTERN LIMITS apply, with notices written to stderr. Other
+  options, e.g. context, --max-count, and --multiline, apply only to stdout.
+
+MERGED OUTPUT (--merge, --stream-tags):
+  The command's stdout and stderr may instead be read as one stream, with
+  the lines from both written to stdout, in the order they were read, which
+  is as close as possible to the order they were written. Other options
+  apply to the merged stream, e.g. line numbers count lines from both,
+  though lines are always matched serially (see --workers). Each line
+  may be tagged with its stream, either as an '[out] ' or '[err] ' prefix
+  (--stream-tags text), or by coloring lines from stderr red (--stream-tags
+  color). Patterns may be restricted to a stream via the directive
+  'stream=out' or 'stream=err' (see PATTERN FILES), e.g.
+  'warning: * #!scof stream=err'. The --raw-log contains only stdout, and
+  --binary only supports 'text'.
+
+RAW LOG (--raw-log):
+  The command's unfiltered stdout may also be written to a file, e.g. to
+  keep as a CI artifact, without it appearing in the console. The file may
+  be rotated once it reaches --raw-log-max-size, in which case the previous
+  files are renamed, like logrotate, i.e. 'raw.log.1' is the most recent,
+  and, optionally, only --raw-log-max-files of them are kept (including any
+  left by a previous run, which are rotated in turn). The files may
+  be gzip compressed (--raw-log-gzip), in which case a '.gz' suffix is kept
+  last, e.g. 'raw.1.gz'. Errors writing the file are reported, but do not
+  otherwise affect filtering.
+
+PARALLEL MATCHING (--workers):
+  With many patterns, matching may take more CPU time than a single core
+  provides. With --workers N, lines are read in batches, which are matched
+  by N goroutines in parallel, then written in their original order. The
+  number of batches in flight is bounded, after which reading stops, until
+  the command's output catches up. By default, lines are matched in
+  parallel, using all available CPUs, only if there are at least 64
+  patterns.
+
+BINARY OUTPUT (--binary):
+  Output is considered binary if the first 8KiB of it (or less, if the
+  command pauses for 10ms before writing that much) contains a NUL byte, or
+  invalid UTF-8. The rest of the output isn't inspected. Policies:
+    - 'text': (Default) No detection, all output is filtered as text.
+    - 'skip': Suppress binary output entirely.
+    - 'pass': Copy binary output through, unfiltered.
+    - 'summary': Filter binary output as usual, but instead of the kept
+      lines, write a single 'Binary output matches' line.
+
 EXIT STATUS AND ERROR MODES (-e, --error-mode):
   Alters exit status based on WRITTEN content, ONLY if the command succeeds.
   If the command fails, its original exit status is used.
@@ -48,6 +241,31 @@ EXIT STATUS AND ERROR MODES (-e, --error-mode):
     - 'default': (Default) Exit status mirrors the command's status.
     - 'no-content': Exit 1 if no content (command succeeded), else 0.
     - 'on-content': Exit 1 if any content (command succeeded), else 0.
+  By default, only stdout is considered. With --error-mode-stderr, lines
+  written to stderr (after STDERR FILTERING, if any) are also content.
+
+MAX COUNT (-m, --max-count):
+  Stops writing output once N lines have been kept (a multi-line record
+  counts as one). Context lines don't count, and aren't written after the
+  last kept line. Actions (--max-count-action):
+    - 'drain': (Default) The rest of the command's output is read and
+      discarded, and the exit status is determined as usual.
+    - 'kill': The command is killed, and the exit status is determined as if
+      the command succeeded, i.e. 0, unless an error mode applies. If the
+      limit isn't reached, the exit status is determined as usual.
+
+ENVIRONMENT:
+  Options may be given defaults via environment variables, named SCOF_ then
+  the option's long name, upper case, with '-' replaced by '_'. For example,
+  SCOF_ERROR_MODE=on-content, SCOF_INVERT_MATCH=true. Options given on the
+  command line take precedence, replacing (not adding to) any values from the
+  environment. Options that may be specified multiple times accept lists:
+    - SCOF_PATTERN, SCOF_STDERR_PATTERN, SCOF_COLLAPSE_NORMALIZE: one per
+      line.
+    - SCOF_PATTERN_FILE, SCOF_STDERR_PATTERN_FILE: separated like PATH (':', or ';' on Windows).
+    - SCOF_PRESET, SCOF_MULTILINE: comma separated.
+  Other SCOF_ variables (e.g. SCOF_V, or typos) are ignored, with a warning.
+  Use --show-options to see where each effective value came from.
 
 OPTIONS:
 `
@@ -59,6 +277,10 @@ func (x *CLI) usage() {
 
 func (x *CLI) init(args []string) error {
 	x.errorMode = errorModeDefault
+	x.longLinePolicy = longLineTruncate
+	x.binaryPolicy = binaryText
+	x.maxCountAction = maxCountDrain
+	x.streamTags = streamTagsNone
 
 	x.flagSet = flag.NewFlagSet("simple-command-output-filter", flag.ContinueOnError)
 
@@ -69,17 +291,129 @@ func (x *CLI) init(args []string) error {
 
 	x.flagSet.Var(&x.rawPatterns, "p", "Pattern to filter by (can be specified multiple times).")
 	x.flagSet.Var(&x.rawPatterns, "pattern", "Alias for -p.")
-	x.flagSet.Var(&x.patternFiles, "f", "File containing patterns, one per line (can be specified multiple times).")
+	x.flagSet.Var(&x.patternFiles, "f", "File, directory of *.patterns files, or glob, containing patterns, one per line (can be specified multiple times).")
 	x.flagSet.Var(&x.patternFiles, "pattern-file", "Alias for -f.")
+	x.flagSet.Var(&x.presets, "preset", "Built-in pattern file to use, see --list-presets (can be specified multiple times).")
+	x.flagSet.BoolVar(&x.listPresets, "list-presets", false, "List the built-in presets, and exit.")
 	x.flagSet.BoolVar(&x.invertMatch, "v", false, "Invert match (selects non-matching lines).")
 	x.flagSet.BoolVar(&x.invertMatch, "invert-match", false, "Alias for -v.")
+	x.flagSet.Var(&x.multiline, "multiline", "Group lines into multi-line records, using a recognizer: 'indent', 'go', 'java', 'python', or 'all' (can be specified multiple times).")
+	x.flagSet.IntVar(&x.afterContext, "A", 0, "Write N lines of context after each kept line.")
+	x.flagSet.IntVar(&x.afterContext, "after-context", 0, "Alias for -A.")
+	x.flagSet.IntVar(&x.beforeContext, "B", 0, "Write N lines of context before each kept line.")
+	x.flagSet.IntVar(&x.beforeContext, "before-context", 0, "Alias for -B.")
+	x.flagSet.IntVar(&x.aroundContext, "C", 0, "Write N lines of context before and after each kept line.")
+	x.flagSet.IntVar(&x.aroundContext, "context", 0, "Alias for -C.")
+	x.flagSet.StringVar(&x.groupSeparator, "group-separator", "--", "Line written between non-contiguous groups of context lines.")
+	x.flagSet.BoolVar(&x.noGroupSeparator, "no-group-separator", false, "Don't write a line between non-contiguous groups of context lines.")
+	x.flagSet.IntVar(&x.maxCount, "m", 0, "Stop after N lines (or multi-line records) have been kept, see --max-count-action (0 is unlimited).")
+	x.flagSet.IntVar(&x.maxCount, "max-count", 0, "Alias for -m.")
+	x.flagSet.Var(&x.maxCountAction, "max-count-action", "Action once --max-count is reached: 'drain' or 'kill'.")
+	x.flagSet.BoolVar(&x.lineNumbers, "n", false, "Prefix each written line with its original line number.")
+	x.flagSet.BoolVar(&x.lineNumbers, "line-number", false, "Alias for -n.")
+	x.flagSet.Var(&x.timestamp, "timestamp", "Prefix each written line with the time it was read: 'wall' (if no value is given), 'elapsed', or a Go time layout (use --timestamp=FORMAT).")
+	x.flagSet.BoolVar(&x.collapseRepeats, "collapse-repeats", false, "Collapse runs of repeated kept lines into the first line, and a 'last line repeated N times' line.")
+	x.flagSet.Var(&x.collapseNormalize, "collapse-normalize", "Regex matching volatile parts of lines (e.g. timestamps), ignored when comparing lines for --collapse-repeats (can be specified multiple times).")
+	x.flagSet.DurationVar(&x.collapseInterval, "collapse-interval", 0, "Write the summary of a run of repeated lines at least this often (e.g. '10s', 0 waits until the run ends).")
+	x.flagSet.BoolVar(&x.lineBuffered, "line-buffered", false, "Write each kept line immediately, rather than buffering output until the command is idle, e.g. for interactive use.")
+	x.flagSet.StringVar(&x.rejectedPath, "rejected", "", "Write the lines that weren't kept to this file, see REJECTED LINES.")
+	x.flagSet.IntVar(&x.rejectedFD, "rejected-fd", 0, "Write the lines that weren't kept to this (inherited) file descriptor, e.g. 3, see REJECTED LINES.")
+	x.flagSet.Var(&x.stderrRawPatterns, "stderr-pattern", "Pattern to filter the command's stderr by, see STDERR FILTERING (can be specified multiple times).")
+	x.flagSet.Var(&x.stderrPatternFiles, "stderr-pattern-file", "Like -f, for --stderr-pattern (can be specified multiple times).")
+	x.flagSet.BoolVar(&x.stderrInvert, "stderr-invert", false, "Invert match for the command's stderr (selects non-matching lines).")
+	x.flagSet.BoolVar(&x.merge, "merge", false, "Filter the command's stdout and stderr as one stream, written to stdout, see MERGED OUTPUT.")
+	x.flagSet.Var(&x.streamTags, "stream-tags", "Identify the stream of each written line, with --merge: 'none', 'text' (an '[out]' or '[err]' prefix), or 'color' (stderr in red).")
+	x.flagSet.StringVar(&x.rawLogPath, "raw-log", "", "Write the command's unfiltered stdout to this file, see RAW LOG.")
+	x.flagSet.Var(&x.rawLogMaxSize, "raw-log-max-size", "Rotate the --raw-log file once it reaches this size, e.g. '100M' (0 is unlimited).")
+	x.flagSet.IntVar(&x.rawLogMaxFiles, "raw-log-max-files", 0, "Maximum number of rotated --raw-log files to keep (0 is unlimited).")
+	x.flagSet.BoolVar(&x.rawLogGzip, "raw-log-gzip", false, "Gzip compress the --raw-log file(s).")
+	x.flagSet.IntVar(&x.workers, "workers", 0, "Number of goroutines matching lines in parallel, see PARALLEL MATCHING (0 is automatic, 1 disables).")
+	x.flagSet.Var(&x.rateLimit, "rate-limit", "Limit the rate of written lines to LINES/DURATION (e.g. '100/1s'), see RATE LIMITING.")
+	x.flagSet.IntVar(&x.perPatternLimit, "per-pattern-limit", 0, "Maximum number of lines (or multi-line records) each pattern may keep, see PER-PATTERN LIMITS (0 is unlimited).")
 	x.flagSet.Var(&x.errorMode, "e", "Error mode: 'default', 'no-content', or 'on-content'.")
 	x.flagSet.Var(&x.errorMode, "error-mode", "Alias for -e.")
+	x.flagSet.BoolVar(&x.errorModeStderr, "error-mode-stderr", false, "Also count lines written to stderr (after filtering) as content, for -e.")
+	x.flagSet.BoolVar(&x.pathGlob, "path-glob", false, "Patterns are path globs, where '*' stops at '/', and '**/' matches any number of directories.")
+	x.flagSet.BoolVar(&x.strictPatterns, "strict-patterns", false, "Reject pattern files containing invalid UTF-8, control characters, or trailing whitespace.")
+	x.flagSet.IntVar(&x.maxLineLength, "max-line-length", 0, "Maximum length of a line, in bytes, before applying --long-lines (0 is unlimited).")
+	x.flagSet.Var(&x.longLinePolicy, "long-lines", "Policy for lines exceeding --max-line-length: 'truncate', 'pass', or 'drop'.")
+	x.flagSet.BoolVar(&x.crSegments, "cr-segments", false, "Treat a carriage return ('\\r') as a line terminator, matching each progress update separately.")
+	x.flagSet.BoolVar(&x.nullData, "z", false, "Records are separated by NUL bytes, instead of newlines.")
+	x.flagSet.BoolVar(&x.nullData, "null-data", false, "Alias for -z.")
+	x.flagSet.StringVar(&x.recordSeparator, "record-separator", "", "Records are separated by this byte string (supports \\0, \\n, \\r, \\t, \\xHH, \\\\), instead of newlines.")
+	x.flagSet.StringVar(&x.recordSeparatorRegex, "record-separator-regex", "", "Records are separated by matches of this regex, instead of newlines.")
+	x.flagSet.Var(&x.binaryPolicy, "binary", "Policy for binary output: 'text', 'skip', 'pass', or 'summary'.")
+	x.flagSet.DurationVar(&x.reloadInterval, "reload-interval", 0, "Poll pattern files for changes at this interval, reloading them (e.g. '2s', 0 disables).")
+
+	x.flagSet.BoolVar(&x.showOptions, "show-options", false, "Show the effective value of each option, and where it came from, and exit.")
 
 	if err := x.flagSet.Parse(args); err != nil {
 		return err // inclusive of flag.ErrHelp
 	}
 
+	if err := x.applyEnv(); err != nil {
+		return err
+	}
+
+	if x.maxLineLength < 0 {
+		return errors.New("invalid max line length: must not be negative")
+	}
+
+	if x.perPatternLimit < 0 {
+		return errors.New("invalid per pattern limit: must not be negative")
+	}
+
+	if x.maxCount < 0 {
+		return errors.New("invalid max count: must not be negative")
+	}
+	if x.workers < 0 {
+		return errors.New("invalid workers: must not be negative")
+	}
+	if x.rejectedFD < 0 {
+		return errors.New("invalid rejected fd: must not be negative")
+	}
+	if x.rejectedPath != `` && x.rejectedFD != 0 {
+		return errors.New("--rejected and --rejected-fd are mutually exclusive")
+	}
+	if x.merge && x.stderrPiped() {
+		return errors.New("--merge can't be used with --stderr-pattern, --stderr-pattern-file, --stderr-invert, or --error-mode-stderr")
+	}
+	if x.merge && x.binaryPolicy != binaryText {
+		return errors.New("--merge can't be used with --binary, other than 'text'")
+	}
+	if x.streamTags.enabled() && !x.merge {
+		return errors.New("--stream-tags requires --merge")
+	}
+	if x.rawLogMaxFiles < 0 {
+		return errors.New("invalid raw log max files: must not be negative")
+	}
+
+	if x.afterContext < 0 || x.beforeContext < 0 || x.aroundContext < 0 {
+		return errors.New("invalid context: must not be negative")
+	}
+
+	if err := x.compileCollapseNormalize(); err != nil {
+		return err
+	}
+
+	if _, err := newRecordRecognizers(x.multiline); err != nil {
+		return err
+	}
+
+	if err := x.resolveRecordSeparator(); err != nil {
+		return err
+	}
+
+	if x.showOptions {
+		x.printOptions(x.Output)
+		return errNoRun
+	}
+
+	if x.listPresets {
+		printPresets(x.Output)
+		return errNoRun
+	}
+
 	cmdArgs := x.flagSet.Args()
 	if len(cmdArgs) == 0 {
 		return errNoCommand
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCLI_init(t *testing.T) {
@@ -127,6 +128,178 @@ func TestCLI_init(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:      "with long line options",
+			args:      []string{"--max-line-length", "1024", "--long-lines", "pass", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.maxLineLength != 1024 || c.longLinePolicy != longLinePass {
+					t.Errorf("Expected max line length 1024 and policy %q, got %d and %q", longLinePass, c.maxLineLength, c.longLinePolicy)
+				}
+			},
+		},
+		{
+			name:      "with default long line policy",
+			args:      []string{"echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.longLinePolicy != longLineTruncate {
+					t.Errorf("Expected long line policy %q, got %q", longLineTruncate, c.longLinePolicy)
+				}
+			},
+		},
+		{
+			name:      "with invalid long line policy",
+			args:      []string{"--long-lines", "wrap", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with negative max line length",
+			args:      []string{"--max-line-length", "-1", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with invalid rate limit",
+			args:      []string{"--rate-limit", "100", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with rate limit",
+			args:      []string{"--rate-limit", "100/s", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.rateLimit != (rateLimit{lines: 100, per: time.Second}) {
+					t.Errorf("Expected rateLimit to be 100/1s, got %s", &c.rateLimit)
+				}
+			},
+		},
+		{
+			name:      "with rejected and rejected fd",
+			args:      []string{"--rejected", "rejected.log", "--rejected-fd", "3", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with negative rejected fd",
+			args:      []string{"--rejected-fd", "-1", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with stderr patterns",
+			args:      []string{"--stderr-pattern", "error:*", "--stderr-invert", "--error-mode-stderr", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.stderrMatcher == nil || len(c.stderrMatcher.patterns) != 1 || c.stderrMatcher.match([]byte("error: x")) != 0 {
+					t.Errorf("Expected 1 compiled stderr pattern, got %v", c.stderrMatcher)
+				}
+				if len(c.compiledPatterns) != 0 {
+					t.Errorf("Expected no compiled patterns, got %v", c.compiledPatterns)
+				}
+				if !c.stderrInvert || !c.errorModeStderr {
+					t.Errorf("Expected stderr invert and error mode stderr to be set")
+				}
+			},
+		},
+		{
+			name:      "with merge",
+			args:      []string{"--merge", "--stream-tags", "color", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if !c.merge || c.streamTags != streamTagsColor {
+					t.Errorf("Expected merge with color stream tags, got %v, %s", c.merge, &c.streamTags)
+				}
+			},
+		},
+		{
+			name:      "with default stream tags",
+			args:      []string{"echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.streamTags != streamTagsNone {
+					t.Errorf("Expected stream tags %q, got %q", streamTagsNone, c.streamTags)
+				}
+			},
+		},
+		{
+			name:      "with invalid stream tags",
+			args:      []string{"--merge", "--stream-tags", "prefix", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with stream tags without merge",
+			args:      []string{"--stream-tags", "text", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with merge and stderr pattern",
+			args:      []string{"--merge", "--stderr-pattern", "error:*", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with merge and binary policy",
+			args:      []string{"--merge", "--binary", "skip", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with missing stderr pattern file",
+			args:      []string{"--stderr-pattern-file", "does-not-exist.patterns", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with negative raw log max files",
+			args:      []string{"--raw-log", "raw.log", "--raw-log-max-files", "-1", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with raw log",
+			args:      []string{"--raw-log", "raw.log", "--raw-log-max-size", "10M", "--raw-log-gzip", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.rawLogPath != "raw.log" || c.rawLogMaxSize != 10<<20 || !c.rawLogGzip {
+					t.Errorf("Expected raw log options to be set, got %q, %d, %v", c.rawLogPath, c.rawLogMaxSize, c.rawLogGzip)
+				}
+			},
+		},
+		{
+			name:      "with negative per-pattern limit",
+			args:      []string{"--per-pattern-limit", "-1", "echo", "hello"},
+			wantError: true,
+		},
+		{
+			name:      "with per-pattern limit",
+			args:      []string{"--per-pattern-limit", "5", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.perPatternLimit != 5 {
+					t.Errorf("Expected perPatternLimit to be 5, got %d", c.perPatternLimit)
+				}
+			},
+		},
+		{
+			name:      "with line numbers and bare timestamp",
+			args:      []string{"-n", "--timestamp", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if !c.lineNumbers {
+					t.Errorf("Expected lineNumbers to be true")
+				}
+				if c.timestamp != timestampWall {
+					t.Errorf("Expected timestamp to be %q, got %q", timestampWall, c.timestamp)
+				}
+				if c.command != "echo" {
+					t.Errorf("Expected command to be 'echo', got %q", c.command)
+				}
+			},
+		},
+		{
+			name:      "with timestamp format",
+			args:      []string{"--timestamp=elapsed", "echo", "hello"},
+			wantError: false,
+			checkFunc: func(t *testing.T, c *CLI) {
+				if c.timestamp != timestampElapsed {
+					t.Errorf("Expected timestamp to be %q, got %q", timestampElapsed, c.timestamp)
+				}
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// outputBufferSize is the size of the buffer for kept lines.
+	outputBufferSize = 64 * 1024
+
+	// idleFlushDelay bounds how long output may remain buffered, e.g. while
+	// the command is writing a partial line.
+	idleFlushDelay = 100 * time.Millisecond
+)
+
+// lockedWriter serializes writes to an underlying writer.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (x *lockedWriter) Write(p []byte) (int, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.w.Write(p)
+}
+
+// lockWriter wraps w, if necessary, such that it may be written to by both
+// os/exec's copying goroutine, and the filter itself. Files are passed to the
+// command directly, and are left as-is, to preserve transparency (e.g. isatty).
+func lockWriter(w io.Writer) io.Writer {
+	if _, ok := w.(*os.File); ok {
+		return w
+	}
+	return &lockedWriter{w: w}
+}
+
+// bufferedWriter buffers writes to an underlying writer, avoiding a write
+// (syscall) per line. The buffer must be flushed explicitly, e.g. when the
+// command is idle, or exits, but is also flushed after idleFlushDelay, which
+// handles writes from other goroutines (e.g. timers).
+type bufferedWriter struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	delay time.Duration
+	timer *time.Timer
+}
+
+func newBufferedWriter(w io.Writer) *bufferedWriter {
+	return &bufferedWriter{
+		w:     bufio.NewWriterSize(w, outputBufferSize),
+		delay: idleFlushDelay,
+	}
+}
+
+func (x *bufferedWriter) Write(p []byte) (int, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	n, err := x.w.Write(p)
+	if x.timer == nil && x.w.Buffered() != 0 {
+		x.timer = time.AfterFunc(x.delay, func() { _ = x.Flush() })
+	}
+	return n, err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (x *bufferedWriter) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.timer != nil {
+		x.timer.Stop()
+		x.timer = nil
+	}
+	return x.w.Flush()
+}
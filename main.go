@@ -7,8 +7,10 @@ import (
 
 func main() {
 	os.Exit((&cli.CLI{
-		Input:  os.Stdin,
-		Output: os.Stdout,
-		ErrOut: os.Stderr,
+		Input:     os.Stdin,
+		Output:    os.Stdout,
+		ErrOut:    os.Stderr,
+		LookupEnv: os.LookupEnv,
+		Environ:   os.Environ,
 	}).Main(os.Args[1:]))
 }